@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"prorickey/nctsa/auth"
 	"prorickey/nctsa/database"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/redis/go-redis/v9"
@@ -33,12 +34,30 @@ func UserAuthMiddleware(rdb *redis.Client) gin.HandlerFunc {
     }
 }
 
+// StreamTokenMiddleware moves the token an EventSource has to send as ?token= into the
+// Authorization header for /user/stream, since browsers can't set headers on one. It runs
+// before the logger and takes the token out of every query, so it never ends up in the logs.
+func StreamTokenMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := c.Request.URL.Query()
+		if token := query.Get("token"); token != "" {
+			if c.Request.URL.Path == "/user/stream" && c.GetHeader("Authorization") == "" {
+				c.Request.Header.Set("Authorization", token)
+			}
+			query.Del("token")
+			c.Request.URL.RawQuery = query.Encode()
+		}
+		c.Next()
+	}
+}
+
 func ApiAuthMiddleware() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
         // Check if the user exists in the database
 		db, exists := ctx.Get("db")
 		if !exists {
 			ctx.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+			ctx.Abort()
 			return
 		}
 
@@ -50,12 +69,17 @@ func ApiAuthMiddleware() gin.HandlerFunc {
             ctx.Abort()
             return
         }
-		key = key[7:] // "Bearer tokenrighthere"
-        _, ok := database.ValidateApiKey(conn, key)
+		key = strings.TrimPrefix(key, "Bearer ") // "Bearer tokenrighthere"
+        apiKey, ok := database.ValidateApiKey(conn, key)
 		if !ok {
 			ctx.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthenticated Client"})
 			ctx.Abort()
 			return
 		}
+
+		// Keep who is making the request around for the audit log
+		ctx.Set("api_key", apiKey)
+		ctx.Set("admin_name", apiKey.AdminName)
+		ctx.Next()
 	}
 }
\ No newline at end of file
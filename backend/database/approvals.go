@@ -0,0 +1,136 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+/*
+Notifications move through draft -> pending -> approved/sent (or rejected).
+Anything that reaches the whole conference, or a large private audience, needs
+a second admin to approve it before it is published. Every step is recorded in
+notification_reviews.
+*/
+
+const (
+	StatusDraft     = "draft"     // not published and not waiting on anything
+	StatusPending   = "pending"   // waiting for a second admin's approval
+	StatusApproved  = "approved"  // approved and waiting for its publishAt
+	StatusRejected  = "rejected"  // turned down by a reviewer
+	StatusSent      = "sent"      // published and sent
+	StatusRetracted = "retracted" // pulled back after being sent
+)
+
+// NotificationReview is one step in the approval history of a notification
+type NotificationReview struct {
+	ID             int64     `json:"id"`
+	NotificationID string    `json:"notificationId"`
+	ActorKeyID     string    `json:"actorKeyId,omitempty"`
+	Actor          string    `json:"actor"`
+	Action         string    `json:"action"` // "submit", "approve", "reject" or "comment"
+	Comment        string    `json:"comment,omitempty"`
+	CreatedAt      time.Time `json:"createdAt"`
+}
+
+var (
+	ErrNotPending  = errors.New("notification is not pending approval")
+	ErrSelfApprove = errors.New("a notification has to be reviewed by a different admin than the one that last edited it")
+	ErrNotAdmin    = errors.New("only admins can approve or reject notifications")
+)
+
+// RecordReview adds a step to a notification's approval history
+func RecordReview(db *sql.DB, review NotificationReview) error {
+	_, err := db.Exec(`
+		INSERT INTO public.notification_reviews (notificationId, actorKeyId, actor, action, comment)
+		VALUES ($1, NULLIF($2, '')::uuid, $3, $4, NULLIF($5, ''))
+	`, review.NotificationID, review.ActorKeyID, review.Actor, review.Action, review.Comment)
+
+	return err
+}
+
+// ListReviews returns the approval history of a notification, oldest first
+func ListReviews(db *sql.DB, notificationID string) ([]NotificationReview, error) {
+	rows, err := db.Query(`
+		SELECT id, notificationId, COALESCE(actorKeyId::text, ''), actor, action, COALESCE(comment, ''), createdAt
+		FROM public.notification_reviews
+		WHERE notificationId = $1
+		ORDER BY createdAt, id
+	`, notificationID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reviews := make([]NotificationReview, 0)
+	for rows.Next() {
+		var r NotificationReview
+		if err := rows.Scan(&r.ID, &r.NotificationID, &r.ActorKeyID, &r.Actor, &r.Action, &r.Comment, &r.CreatedAt); err != nil {
+			return reviews, err
+		}
+		reviews = append(reviews, r)
+	}
+
+	return reviews, rows.Err()
+}
+
+// ApproveNotification approves a pending notification. It is published straight away
+// unless it has a publishAt still to come, in which case the scheduler publishes it.
+// The approver has to be an admin's key, and not whoever created or last edited it.
+func ApproveNotification(db *sql.DB, id string, approverKeyID string) (Notification, error) {
+	notif, err := scanNotification(db.QueryRow(`
+		UPDATE public.notifications SET
+			status = CASE WHEN publishAt > CURRENT_TIMESTAMP THEN 'approved' ELSE 'sent' END,
+			published = NOT COALESCE(publishAt > CURRENT_TIMESTAMP, false),
+			publishAt = CASE WHEN publishAt > CURRENT_TIMESTAMP THEN publishAt END
+		WHERE id = $1 AND status = 'pending' AND deletedAt IS NULL
+			AND submittedByKeyId IS DISTINCT FROM NULLIF($2, '')::uuid
+			AND EXISTS (SELECT 1 FROM public.admins WHERE apiKeyId::text = $2)
+		RETURNING `+notificationColumns, id, approverKeyID))
+
+	if err == sql.ErrNoRows {
+		return notif, approvalError(db, id, approverKeyID)
+	}
+
+	return notif, err
+}
+
+// RejectNotification turns down a pending notification. Like approving, the reviewer has
+// to be an admin's key, and not whoever created or last edited it.
+func RejectNotification(db *sql.DB, id string, reviewerKeyID string) (Notification, error) {
+	notif, err := scanNotification(db.QueryRow(`
+		UPDATE public.notifications SET status = 'rejected', published = false, publishAt = NULL
+		WHERE id = $1 AND status = 'pending' AND deletedAt IS NULL
+			AND submittedByKeyId IS DISTINCT FROM NULLIF($2, '')::uuid
+			AND EXISTS (SELECT 1 FROM public.admins WHERE apiKeyId::text = $2)
+		RETURNING `+notificationColumns, id, reviewerKeyID))
+
+	if err == sql.ErrNoRows {
+		return notif, approvalError(db, id, reviewerKeyID)
+	}
+
+	return notif, err
+}
+
+// approvalError works out why an approval or rejection didn't go through
+func approvalError(db *sql.DB, id string, reviewerKeyID string) error {
+	var status string
+	err := db.QueryRow(`SELECT status FROM public.notifications WHERE id = $1 AND deletedAt IS NULL`, id).Scan(&status)
+	if err != nil {
+		return err
+	}
+	if status != StatusPending {
+		return ErrNotPending
+	}
+
+	var admin bool
+	err = db.QueryRow(`SELECT EXISTS (SELECT 1 FROM public.admins WHERE apiKeyId::text = $1)`, reviewerKeyID).Scan(&admin)
+	if err != nil {
+		return err
+	}
+	if !admin {
+		return ErrNotAdmin
+	}
+
+	return ErrSelfApprove
+}
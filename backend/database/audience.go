@@ -0,0 +1,277 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// Target is one group of people a notification is for. A notification goes to
+// everyone that matches any of its targets.
+type Target struct {
+	Type string `json:"type"`         // all, user, school, event, role or advisors
+	ID   string `json:"id,omitempty"` // The user, school or event id, or the role name. Advisors takes a school id.
+}
+
+const (
+	TargetAll      = "all"
+	TargetUser     = "user"
+	TargetSchool   = "school"
+	TargetEvent    = "event"
+	TargetRole     = "role"
+	TargetAdvisors = "advisors"
+)
+
+const RoleAdvisor = "advisor"
+
+var ErrInvalidTarget = errors.New("invalid target")
+
+// DeviceRecipient is a device a notification goes to and the user it belongs to
+type DeviceRecipient struct {
+	UserID      string
+	Token       string
+	DeviceType  string
+	Environment string
+}
+
+// AudienceSize is how many people and devices a set of targets reaches
+type AudienceSize struct {
+	Users   int `json:"users"`
+	Devices int `json:"devices"`
+}
+
+/*
+audienceMatch is the condition for a row of users (u) being in the targets
+held as jsonb in expr. Visibility in the app, push delivery and the audience
+size all go through it so they can't disagree about who a notification is for.
+The "all" target also matches when u is NULL, for devices without a user.
+*/
+func audienceMatch(expr string) string {
+	return `EXISTS (
+		SELECT 1 FROM jsonb_to_recordset(COALESCE(` + expr + `, '[]'::jsonb)) AS t(type TEXT, id TEXT)
+		WHERE t.type = 'all'
+			OR (t.type = 'user' AND u.id::text = t.id)
+			OR (t.type = 'school' AND u.schoolId::text = t.id)
+			OR (t.type = 'role' AND u.role = t.id)
+			OR (t.type = 'advisors' AND u.role = '` + RoleAdvisor + `' AND u.schoolId::text = t.id)
+			OR (t.type = 'event' AND EXISTS (
+				SELECT 1 FROM public.user_agenda ua WHERE ua.userId = u.id AND ua.eventId::text = t.id
+			))
+	)`
+}
+
+// TargetsAll reports whether the targets reach everyone
+func TargetsAll(targets []Target) bool {
+	for _, target := range targets {
+		if target.Type == TargetAll {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ValidateTargets checks every target has a known type and an id where it needs one
+func ValidateTargets(targets []Target) error {
+	if len(targets) == 0 {
+		return fmt.Errorf("%w: at least one target is required", ErrInvalidTarget)
+	}
+
+	for _, target := range targets {
+		switch target.Type {
+		case TargetAll:
+		case TargetRole:
+			if target.ID == "" {
+				return fmt.Errorf("%w: role targets need a role", ErrInvalidTarget)
+			}
+		case TargetUser, TargetSchool, TargetEvent, TargetAdvisors:
+			if _, err := uuid.Parse(target.ID); err != nil {
+				return fmt.Errorf("%w: %s targets need a valid id", ErrInvalidTarget, target.Type)
+			}
+		default:
+			return fmt.Errorf("%w: unknown type %q", ErrInvalidTarget, target.Type)
+		}
+	}
+
+	return nil
+}
+
+// TargetsFromIDs works out what each id in an old style userids list is. They
+// could be a user, a school or an event, so each is looked up in that order.
+func TargetsFromIDs(db *sql.DB, ids []string) ([]Target, error) {
+	for _, id := range ids {
+		if _, err := uuid.Parse(id); err != nil {
+			return nil, fmt.Errorf("%w: %q is not a valid id", ErrInvalidTarget, id)
+		}
+	}
+
+	rows, err := db.Query(`
+		SELECT x::text, CASE
+			WHEN EXISTS (SELECT 1 FROM public.users WHERE id = x) THEN 'user'
+			WHEN EXISTS (SELECT 1 FROM public.school WHERE id = x) THEN 'school'
+			WHEN EXISTS (SELECT 1 FROM public.event WHERE id = x) THEN 'event'
+			ELSE '' END
+		FROM unnest($1::uuid[]) AS x
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	targets := make([]Target, 0, len(ids))
+	for rows.Next() {
+		var target Target
+		if err := rows.Scan(&target.ID, &target.Type); err != nil {
+			return nil, err
+		}
+		if target.Type == "" {
+			return nil, fmt.Errorf("%w: %s is not a user, school or event", ErrInvalidTarget, target.ID)
+		}
+		targets = append(targets, target)
+	}
+
+	return targets, rows.Err()
+}
+
+// NormalizeTargets fills in the targets of a notification saved the old way, with
+// private and userids, and checks them. Private is kept in step with the targets.
+func NormalizeTargets(db *sql.DB, notif *Notification) error {
+	if len(notif.Targets) == 0 {
+		if !notif.Private {
+			notif.Targets = []Target{{Type: TargetAll}}
+		} else if len(notif.UserIDS) == 0 {
+			return fmt.Errorf("%w: targets are required for private notifications", ErrInvalidTarget)
+		} else {
+			targets, err := TargetsFromIDs(db, notif.UserIDS)
+			if err != nil {
+				return err
+			}
+			notif.Targets = targets
+		}
+	}
+
+	if err := ValidateTargets(notif.Targets); err != nil {
+		return err
+	}
+
+	notif.Private = !TargetsAll(notif.Targets)
+	notif.UserIDS = nil
+	return nil
+}
+
+// targetsParam is the targets as the jsonb the queries take
+func targetsParam(targets []Target) (string, error) {
+	if targets == nil {
+		targets = []Target{}
+	}
+
+	raw, err := json.Marshal(targets)
+	return string(raw), err
+}
+
+// GetAudienceDevices returns the devices the targets reach and who they belong to
+func GetAudienceDevices(db *sql.DB, targets []Target) ([]DeviceRecipient, error) {
+	param, err := targetsParam(targets)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT DISTINCT COALESCE(u.id::text, ''), d.token, d.deviceType, d.environment
+		FROM public.devices d LEFT JOIN public.users u ON u.id = d.userId
+		WHERE `+audienceMatch("$1::jsonb"), param)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanRecipients(rows)
+}
+
+func scanRecipients(rows *sql.Rows) ([]DeviceRecipient, error) {
+	recipients := make([]DeviceRecipient, 0)
+	for rows.Next() {
+		var recipient DeviceRecipient
+		if err := rows.Scan(&recipient.UserID, &recipient.Token, &recipient.DeviceType, &recipient.Environment); err != nil {
+			return nil, err
+		}
+		recipients = append(recipients, recipient)
+	}
+
+	return recipients, rows.Err()
+}
+
+// CountAudience counts the users and devices the targets reach
+func CountAudience(db *sql.DB, targets []Target) (AudienceSize, error) {
+	var size AudienceSize
+
+	param, err := targetsParam(targets)
+	if err != nil {
+		return size, err
+	}
+
+	err = db.QueryRow(`SELECT COUNT(*) FROM public.users u WHERE `+audienceMatch("$1::jsonb"), param).Scan(&size.Users)
+	if err != nil {
+		return size, err
+	}
+
+	err = db.QueryRow(`
+		SELECT COUNT(DISTINCT d.token)
+		FROM public.devices d LEFT JOIN public.users u ON u.id = d.userId
+		WHERE `+audienceMatch("$1::jsonb"), param).Scan(&size.Devices)
+
+	return size, err
+}
+
+// VisibleNotificationIDs returns the ids of the published notifications the user is in the audience of
+func VisibleNotificationIDs(db *sql.DB, userID string) (map[string]bool, error) {
+	rows, err := db.Query(`
+		SELECT n.id FROM public.notifications n, public.users u
+		WHERE u.id = $1 AND n.published = true AND n.deletedAt IS NULL AND `+audienceMatch("n.targets"), userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	visible := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		visible[id] = true
+	}
+
+	return visible, rows.Err()
+}
+
+// UsersInAudience returns which of the users are in the targets
+func UsersInAudience(db *sql.DB, targets []Target, userIDs []string) (map[string]bool, error) {
+	param, err := targetsParam(targets)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT u.id FROM public.users u
+		WHERE u.id::text = ANY($2) AND `+audienceMatch("$1::jsonb"), param, pq.Array(userIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		members[id] = true
+	}
+
+	return members, rows.Err()
+}
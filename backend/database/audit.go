@@ -0,0 +1,109 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// AuditEntry is one row of the append-only audit log of admin mutations
+type AuditEntry struct {
+	ID         int64           `json:"id"`
+	ActorKeyID string          `json:"actorKeyId,omitempty"`
+	Actor      string          `json:"actor"`
+	Action     string          `json:"action"`
+	EntityType string          `json:"entityType"`
+	EntityID   string          `json:"entityId,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+	IP         string          `json:"ip"`
+	CreatedAt  time.Time       `json:"createdAt"`
+}
+
+// AuditFilter narrows down the audit log listing
+type AuditFilter struct {
+	Since time.Time
+	Until time.Time
+}
+
+// RecordAudit appends an entry to the audit log. Before and After are marshalled
+// to JSON, nil means there was no value (created or deleted).
+func RecordAudit(db *sql.DB, entry AuditEntry, before any, after any) error {
+	beforeJSON, err := auditJSON(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := auditJSON(after)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO public.audit_log (actorKeyId, actor, action, entityType, entityId, before, after, ip)
+		VALUES (NULLIF($1, '')::uuid, $2, $3, $4, NULLIF($5, ''), $6, $7, $8)
+	`, entry.ActorKeyID, entry.Actor, entry.Action, entry.EntityType, entry.EntityID, beforeJSON, afterJSON, entry.IP)
+
+	return err
+}
+
+func auditJSON(value any) (any, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal audit value: %w", err)
+	}
+
+	return string(raw), nil
+}
+
+// ListAuditLog returns one page of the audit log, newest first by default
+func ListAuditLog(db *sql.DB, opts ListOptions, filter AuditFilter) (Page[AuditEntry], error) {
+	q := listQuery{
+		from:    "audit_log",
+		columns: "id, COALESCE(actorKeyId::text, ''), actor, action, entityType, COALESCE(entityId, ''), before, after, COALESCE(ip, ''), createdAt",
+		sortable: map[string]string{
+			"createdAt": "createdAt",
+		},
+		filterable: map[string]string{
+			"actor":      "actor",
+			"actorKeyId": "actorKeyId",
+			"action":     "action",
+			"entityType": "entityType",
+			"entityId":   "entityId",
+		},
+		defaultSort: "createdAt",
+		tiebreaker:  "id",
+	}
+
+	if opts.Sort == "" {
+		opts.Desc = true
+	}
+
+	var extra []string
+	var args []any
+	if !filter.Since.IsZero() {
+		args = append(args, filter.Since)
+		extra = append(extra, fmt.Sprintf("createdAt >= $%d", len(args)))
+	}
+	if !filter.Until.IsZero() {
+		args = append(args, filter.Until)
+		extra = append(extra, fmt.Sprintf("createdAt < $%d", len(args)))
+	}
+
+	return runList(db, q, opts, extra, args, func(rows *sql.Rows) (AuditEntry, error) {
+		var entry AuditEntry
+		var before, after []byte
+		err := rows.Scan(&entry.ID, &entry.ActorKeyID, &entry.Actor, &entry.Action, &entry.EntityType, &entry.EntityID, &before, &after, &entry.IP, &entry.CreatedAt)
+		if before != nil {
+			entry.Before = before
+		}
+		if after != nil {
+			entry.After = after
+		}
+		return entry, err
+	})
+}
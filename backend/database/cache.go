@@ -6,8 +6,6 @@ import (
 	"log"
 	"sync"
 	"time"
-
-	"github.com/lib/pq"
 )
 
 /*
@@ -52,33 +50,15 @@ func StartCachingScheduler(db *sql.DB) {
 
 // loadNotificationData loads notification data into the cache from the database
 func loadNotificationData(db *sql.DB) {
-	rows, err := db.Query(`SELECT id, title, description, date, createdAt, published, private, type, userids FROM "notifications"`)
+	rows, err := db.Query(`SELECT ` + notificationColumns + ` FROM "notifications" WHERE deletedAt IS NULL`)
 	if err != nil {
 		log.Printf("Error querying notifications: %v", err)
 		return
 	}
 
-	defer rows.Close()
-
-	notifications := make([]Notification, 0)
-	for rows.Next() {
-		var notif Notification
-		var userIDs pq.StringArray
-		err := rows.Scan(&notif.ID, &notif.Title, &notif.Description, &notif.Date, &notif.CreatedAt, &notif.Published, &notif.Private, &notif.Type, &userIDs)
-		if err != nil {
-			log.Printf("Error scanning notifications: %v", err)
-			return
-		}
-		notif.UserIDS = make([]string, 0)
-        for _, id := range userIDs {
-            notif.UserIDS = append(notif.UserIDS, id)
-        }
-		notifications = append(notifications, notif)
-	}
-
-	// Check for any errors encountered during the iteration
-	if err := rows.Err(); err != nil {
-		log.Printf("Error iterating notifications: %v", err)
+	notifications, err := scanNotifications(rows)
+	if err != nil {
+		log.Printf("Error scanning notifications: %v", err)
 		return
 	}
 
@@ -87,7 +67,7 @@ func loadNotificationData(db *sql.DB) {
 
 // loadAgendaData loads agenda data into the cache from the database
 func loadAgendaData(db *sql.DB) {
-	rows, err := db.Query(`SELECT id, title, description, date, endtime, location, published, icon, createdAt FROM "agenda" WHERE eventid IS NULL`)
+	rows, err := db.Query(`SELECT id, title, description, date, endtime, location, published, icon, createdAt, publishAt FROM "agenda" WHERE eventid IS NULL AND deletedAt IS NULL`)
 	if err != nil {
 		log.Printf("Error querying agenda: %v", err)
 		return
@@ -98,11 +78,13 @@ func loadAgendaData(db *sql.DB) {
 	agendas := make([]Agenda, 0)
 	for rows.Next() {
 		var agenda Agenda
-		err := rows.Scan(&agenda.ID, &agenda.Title, &agenda.Description, &agenda.Date, &agenda.EndTime, &agenda.Location, &agenda.Published, &agenda.Icon, &agenda.CreatedAt)
+		var publishAt sql.NullTime
+		err := rows.Scan(&agenda.ID, &agenda.Title, &agenda.Description, &agenda.Date, &agenda.EndTime, &agenda.Location, &agenda.Published, &agenda.Icon, &agenda.CreatedAt, &publishAt)
 		if err != nil {
 			log.Printf("Error scanning agenda: %v", err)
 			return
 		}
+		agenda.PublishAt = TimePtr(publishAt)
 		agendas = append(agendas, agenda)
 	}
 
@@ -116,7 +98,7 @@ func loadAgendaData(db *sql.DB) {
 }
 
 func loadEventData(db *sql.DB) {
-	rows, err := db.Query(`SELECT id, name, location, "startTime", "endTime", createdAt FROM "event"`)
+	rows, err := db.Query(`SELECT id, name, location, "startTime", "endTime", createdAt FROM "event" WHERE deletedAt IS NULL`)
 	if err != nil {
 		log.Printf("Error querying events: %v", err)
 		return
@@ -209,6 +191,8 @@ func GetEventCache() ([]Event, error) {
 }
 
 func AddAgendaItemToCache(agenda Agenda) {
+	defer publishChange(agendaChange(ChangeAdded, nil, &agenda))
+
 	if val, ok := cache.Load("agenda_data"); ok {
 		agendas := val.([]Agenda)
 		agendas = append(agendas, agenda)
@@ -223,10 +207,12 @@ func UpdateAgendaItemInCache(agenda Agenda) {
 			if a.ID == agenda.ID {
 				agendas[i] = agenda
 				cache.Store("agenda_data", agendas)
+				publishChange(agendaChange(ChangeUpdated, &a, &agenda))
 				return
 			}
 		}
 	}
+	publishChange(agendaChange(ChangeUpdated, nil, &agenda))
 
 	c, _ := GetAgendaCache()
 	log.Printf("Agenda cache: %v", c)
@@ -239,6 +225,7 @@ func DeleteAgendaItemFromCache(id string) {
 			if a.ID == id {
 				agendas = append(agendas[:i], agendas[i+1:]...)
 				cache.Store("agenda_data", agendas)
+				publishChange(agendaChange(ChangeDeleted, &a, nil))
 				return
 			}
 		}
@@ -246,6 +233,8 @@ func DeleteAgendaItemFromCache(id string) {
 }
 
 func AddEventToCache(event Event) {
+	defer publishChange(Change{Collection: CollectionEvents, Action: ChangeAdded, ID: event.ID, Visible: true})
+
 	if val, ok := cache.Load("event_data"); ok {
 		events := val.([]Event)
 		events = append(events, event)
@@ -254,6 +243,8 @@ func AddEventToCache(event Event) {
 }
 
 func UpdateEventInCache(event Event) {
+	defer publishChange(Change{Collection: CollectionEvents, Action: ChangeUpdated, ID: event.ID, Visible: true})
+
 	if val, ok := cache.Load("event_data"); ok {
 		events := val.([]Event)
 		for i, e := range events {
@@ -267,6 +258,8 @@ func UpdateEventInCache(event Event) {
 }
 
 func DeleteEventFromCache(id string) {
+	defer publishChange(Change{Collection: CollectionEvents, Action: ChangeDeleted, ID: id, Visible: true})
+
 	if val, ok := cache.Load("event_data"); ok {
 		events := val.([]Event)
 		for i, e := range events {
@@ -281,6 +274,8 @@ func DeleteEventFromCache(id string) {
 
 // AddNotificationToCache adds a new notification to the cache
 func AddNotificationToCache(notification Notification) {
+	defer publishChange(notificationChange(ChangeAdded, nil, &notification))
+
 	if val, ok := cache.Load("notification_data"); ok {
 		notifications := val.([]Notification)
 		notifications = append(notifications, notification)
@@ -296,10 +291,12 @@ func UpdateNotificationInCache(notification Notification) {
 			if n.ID == notification.ID {
 				notifications[i] = notification
 				cache.Store("notification_data", notifications)
+				publishChange(notificationChange(ChangeUpdated, &n, &notification))
 				return
 			}
 		}
 	}
+	publishChange(notificationChange(ChangeUpdated, nil, &notification))
 }
 
 // DeleteNotificationFromCache removes a notification from the cache
@@ -310,6 +307,7 @@ func DeleteNotificationFromCache(id string) {
 			if n.ID == id {
 				notifications = append(notifications[:i], notifications[i+1:]...)
 				cache.Store("notification_data", notifications)
+				publishChange(notificationChange(ChangeDeleted, &n, nil))
 				return
 			}
 		}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"sync"
+)
+
+// Collections of cached data the apps fetch
+const (
+	CollectionAgenda        = "agenda"
+	CollectionEvents        = "events"
+	CollectionNotifications = "notifications"
+)
+
+// Actions that can happen to something in a collection
+const (
+	ChangeAdded   = "added"
+	ChangeUpdated = "updated"
+	ChangeDeleted = "deleted"
+)
+
+// Change is something in the cached data changing. Visible is whether the apps could
+// see it before or after, edits to drafts don't matter to them. Targets is who a
+// notification is for, everyone can see agenda items and events. Emergency is set
+// for emergency notifications, so they can be told apart without a lookup.
+type Change struct {
+	Collection string   `json:"collection"`
+	Action     string   `json:"action"`
+	ID         string   `json:"id"`
+	Visible    bool     `json:"-"`
+	Targets    []Target `json:"-"`
+	Emergency  bool     `json:"emergency,omitempty"`
+}
+
+var (
+	changeHooksMu sync.RWMutex
+	changeHooks   []func(Change)
+)
+
+// OnChange registers a hook that is called whenever the cached agenda, events or
+// notifications change on this replica. Hooks are called in line so shouldn't block.
+func OnChange(hook func(Change)) {
+	changeHooksMu.Lock()
+	defer changeHooksMu.Unlock()
+	changeHooks = append(changeHooks, hook)
+}
+
+// publishChange calls the change hooks
+func publishChange(change Change) {
+	changeHooksMu.RLock()
+	defer changeHooksMu.RUnlock()
+
+	for _, hook := range changeHooks {
+		hook(change)
+	}
+}
+
+// agendaChange is the change for an agenda item, visible if it was or is published
+func agendaChange(action string, before *Agenda, after *Agenda) Change {
+	change := Change{Collection: CollectionAgenda, Action: action}
+	for _, item := range []*Agenda{before, after} {
+		if item != nil {
+			change.ID = item.ID
+			change.Visible = change.Visible || item.Published
+		}
+	}
+	return change
+}
+
+// notificationChange is the change for a notification, visible to its targets if it was or is published
+func notificationChange(action string, before *Notification, after *Notification) Change {
+	change := Change{Collection: CollectionNotifications, Action: action}
+	for _, notif := range []*Notification{before, after} {
+		if notif != nil {
+			change.ID = notif.ID
+			change.Visible = change.Visible || notif.Published
+			change.Targets = append(change.Targets, notif.Targets...)
+			change.Emergency = change.Emergency || notif.Type == TypeEmergency
+		}
+	}
+	return change
+}
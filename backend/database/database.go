@@ -2,7 +2,6 @@ package database
 
 import (
 	"database/sql"
-	"fmt"
 	"log"
 	"os"
 	"time"
@@ -62,7 +61,12 @@ func initializeDatabase(db *sql.DB) {
 
 func ValidateApiKey(db *sql.DB, key string) (ApiKey, bool) {
 	var apiKey ApiKey
-	err := db.QueryRow("SELECT * FROM api_keys WHERE key = $1", key).Scan(&apiKey.ID, &apiKey.Key, &apiKey.Purpose, &apiKey.CreatedAt)
+	// The admin the key belongs to comes along, every admin request needs it for the audit log
+	err := db.QueryRow(`
+		SELECT k.id, k.key, k.purpose, k.createdAt, COALESCE(a.fullName, '')
+		FROM api_keys k LEFT JOIN admins a ON a.apiKeyId = k.id
+		WHERE k.key = $1
+	`, key).Scan(&apiKey.ID, &apiKey.Key, &apiKey.Purpose, &apiKey.CreatedAt, &apiKey.AdminName)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return ApiKey{}, false
@@ -100,7 +104,9 @@ func RetrieveUserAgenda(db *sql.DB, userID string) ([]Agenda, error) {
         SELECT a.id, a.title, a.description, a.date, a.location, a.published, a.eventId
         FROM public.agenda a
         JOIN public.user_agenda ua ON a.eventId = ua.eventId
+        JOIN public.event e ON e.id = a.eventId
         WHERE ua.userId = $1 AND a.eventId IS NOT NULL AND a.published = true
+            AND a.deletedAt IS NULL AND e.deletedAt IS NULL
     `, userID)
 
 	if err != nil {
@@ -126,7 +132,7 @@ func RetrieveUserAgendaEvents(db *sql.DB, userID string) ([]Event, error) {
 		SELECT e.id, e.name
 		FROM public.event e
 		JOIN public.user_agenda ua ON e.id = ua.eventId
-		WHERE ua.userId = $1
+		WHERE ua.userId = $1 AND e.deletedAt IS NULL
 	`, userID)
 
 	if err != nil {
@@ -149,7 +155,7 @@ func RetrieveUserAgendaEvents(db *sql.DB, userID string) ([]Event, error) {
 
 func EventExists(db *sql.DB, eventID string) bool {
 	var exists bool
-	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM public.event WHERE id = $1)", eventID).Scan(&exists)
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM public.event WHERE id = $1 AND deletedAt IS NULL)", eventID).Scan(&exists)
 	if err != nil {
 		log.Printf("Error checking if event exists: %v", err)
 		return false
@@ -186,196 +192,111 @@ func RemoveEventFromAgenda(db *sql.DB, userID string, eventID string) error {
 	return nil
 }
 
-func GetDeviceToken(db *sql.DB, userid string) ([]string, error) {
-	query := `
-	WITH RECURSIVE user_tokens AS (
-	    SELECT
-	        d.token
-	    FROM
-	        public.devices d
-	    JOIN
-	        public.users u ON d.userId = u.id
-	    WHERE
-	        u.id = $1
-	        AND d.deviceType = 'ios'
-	    UNION ALL
-	    SELECT
-	        d.token
-	    FROM
-	        public.devices d
-	    JOIN
-	        public.users u ON d.userId = u.id
-	    WHERE
-	        u.schoolId = $1
-	        AND d.deviceType = 'ios'
-	    UNION ALL
-	    SELECT
-	        d.token
-	    FROM
-	        public.devices d
-	    JOIN
-	        public.users u ON d.userId = u.id
-	    JOIN
-	        public.user_agenda ua ON ua.userId = u.id
-	    WHERE
-	        ua.eventId = $1
-	        AND d.deviceType = 'ios'
-	)
-	SELECT DISTINCT
-	    token
-	FROM
-	    user_tokens;
-	`
-
-	rows, err := db.Query(query, userid)
-	if err != nil {
-		return nil, fmt.Errorf("failed to execute query: %v", err)
+// ListUsers returns one page of users, optionally fuzzy matching a search on their names
+func ListUsers(db *sql.DB, opts ListOptions) (Page[User], error) {
+	q := listQuery{
+		from:    "users",
+		columns: "id, fullname, shortname, COALESCE(schoolid::text, ''), role",
+		sortable: map[string]string{
+			"fullName":  "fullname",
+			"shortName": "shortname",
+			"tsaId":     "tsaid",
+		},
+		filterable: map[string]string{
+			"id":       "id",
+			"schoolId": "schoolid",
+			"tsaId":    "tsaid",
+			"role":     "role",
+		},
+		defaultSort: "fullName",
+		tiebreaker:  "id",
 	}
-	defer rows.Close()
 
-	var tokens []string
-	for rows.Next() {
-		var token string
-		if err := rows.Scan(&token); err != nil {
-			return nil, fmt.Errorf("failed to scan row: %v", err)
-		}
-		tokens = append(tokens, token)
-	}
+	// Fuzzy search on fullname and shortname
+	q, opts, extra, args := withSearch(q, opts, "fullname", "shortname")
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("row iteration error: %v", err)
-	}
-
-	return tokens, nil
+	return runList(db, q, opts, extra, args, func(rows *sql.Rows) (User, error) {
+		var user User
+		err := rows.Scan(&user.ID, &user.FullName, &user.ShortName, &user.SchoolID, &user.Role)
+		return user, err
+	})
 }
 
-func GetUsers(db *sql.DB, searchTerm string) ([]User, error) {
-	var rows *sql.Rows
-	var err error
-	
-	if searchTerm != "" {
-		// Case insensitive search on fullname and shortname
-		query := `
-			SELECT id, fullname, shortname, schoolid 
-			FROM users 
-			WHERE 
-				LOWER(fullname) LIKE LOWER($1) OR 
-				LOWER(shortname) LIKE LOWER($1)
-		`
-		searchParam := "%" + searchTerm + "%"
-		rows, err = db.Query(query, searchParam)
-	} else {
-		rows, err = db.Query("SELECT id, fullname, shortname, schoolid FROM users")
-	}
-	
-	if err != nil {
-		log.Printf("Error querying users: %v", err)
-		return nil, err
+// ListSchools returns one page of schools, optionally fuzzy matching a search on their name
+func ListSchools(db *sql.DB, opts ListOptions) (Page[School], error) {
+	q := listQuery{
+		from:    "school",
+		columns: "id, schoolname, privatecode",
+		sortable: map[string]string{
+			"name":  "schoolname",
+			"tsaId": "tsaid",
+		},
+		filterable: map[string]string{
+			"id":          "id",
+			"tsaId":       "tsaid",
+			"privateCode": "privatecode",
+		},
+		defaultSort: "name",
+		tiebreaker:  "id",
 	}
-	defer rows.Close()
 
-	users := make([]User, 0)
-	for rows.Next() {
-		var user User
-		if err := rows.Scan(&user.ID, &user.FullName, &user.ShortName, &user.SchoolID); err != nil {
-			log.Printf("Error scanning user: %v", err)
-			continue
-		}
-		users = append(users, user)
-	}
+	// Fuzzy search on school name
+	q, opts, extra, args := withSearch(q, opts, "schoolname")
 
-	return users, nil
+	return runList(db, q, opts, extra, args, func(rows *sql.Rows) (School, error) {
+		var school School
+		err := rows.Scan(&school.ID, &school.Name, &school.PrivateCode)
+		return school, err
+	})
 }
 
-func GetSchools(db *sql.DB, searchTerm string) ([]School, error) {
-	var rows *sql.Rows
-	var err error
-	
-	if searchTerm != "" {
-		// Case insensitive search on school name
-		query := `
-			SELECT id, schoolname, privatecode 
-			FROM school 
-			WHERE LOWER(schoolname) LIKE LOWER($1)
-		`
-		searchParam := "%" + searchTerm + "%"
-		rows, err = db.Query(query, searchParam)
-	} else {
-		rows, err = db.Query("SELECT id, schoolname, privatecode FROM school")
+// ListEvents returns one page of events, optionally fuzzy matching a search on their name
+func ListEvents(db *sql.DB, opts ListOptions) (Page[Event], error) {
+	q := listQuery{
+		from:    "event",
+		where:   []string{"deletedAt IS NULL"},
+		columns: `id, name, location, "startTime", "endTime", createdAt`,
+		sortable: map[string]string{
+			"name":      "name",
+			"location":  "location",
+			"startTime": `"startTime"`,
+			"endTime":   `"endTime"`,
+			"createdAt": "createdAt",
+		},
+		filterable: map[string]string{
+			"id":       "id",
+			"location": "location",
+		},
+		defaultSort: "name",
+		tiebreaker:  "id",
 	}
-	
-	if err != nil {
-		log.Printf("Error querying schools: %v", err)
-		return nil, err
-	}
-	defer rows.Close()
 
-	schools := make([]School, 0)
-	for rows.Next() {
-		var school School
-		if err := rows.Scan(&school.ID, &school.Name, &school.PrivateCode); err != nil {
-			log.Printf("Error scanning school: %v", err)
-			continue
-		}
-		schools = append(schools, school)
-	}
+	// Fuzzy search on event name
+	q, opts, extra, args := withSearch(q, opts, "name")
 
-	return schools, nil
+	return runList(db, q, opts, extra, args, func(rows *sql.Rows) (Event, error) {
+		var evt Event
+		err := rows.Scan(&evt.ID, &evt.Name, &evt.Location, &evt.StartTime, &evt.EndTime, &evt.CreatedAt)
+		return evt, err
+	})
 }
 
-func GetAllAppleDeviceTokens(db *sql.DB) ([]string, error) {
-	rows, err := db.Query("SELECT token FROM devices WHERE devicetype = 'ios'")
-	if err != nil {
-		log.Printf("Error querying device tokens: %v", err)
-		return nil, err // Return nil and the error if the query fails
-	}
-	
-	defer rows.Close()
-	
-	tokens := []string{}
-	for rows.Next() {
-		var token string
-		if err := rows.Scan(&token); err != nil {
-			log.Printf("Error scanning token: %v", err)
-			continue
-		}
-		tokens = append(tokens, token)
-	}
-
-	return tokens, nil
+// GetAgendaItem loads a single agenda item, general or event linked, that isn't in the trash
+func GetAgendaItem(db *sql.DB, id string) (Agenda, error) {
+	var item Agenda
+	var eventID sql.NullString
+	var publishAt sql.NullTime
+	err := db.QueryRow(`SELECT id, title, description, date, endtime, location, published, icon, eventId, createdAt, publishAt FROM "agenda" WHERE id = $1 AND deletedAt IS NULL`, id).
+		Scan(&item.ID, &item.Title, &item.Description, &item.Date, &item.EndTime, &item.Location, &item.Published, &item.Icon, &eventID, &item.CreatedAt, &publishAt)
+	item.EventId = eventID.String
+	item.PublishAt = TimePtr(publishAt)
+	return item, err
 }
 
-func GetAllEvents(db *sql.DB, searchTerm string) ([]Event, error) {
-	var rows *sql.Rows
-	var err error
-	
-	if searchTerm != "" {
-		query := `
-			SELECT id, name
-			FROM event
-			WHERE LOWER(name) LIKE LOWER($1)
-		`
-		searchParam := "%" + searchTerm + "%"
-		rows, err = db.Query(query, searchParam)
-	} else {
-		rows, err = db.Query("SELECT id, name FROM event")
-	}
-	
-	if err != nil {
-		log.Printf("Error querying events: %v", err)
-		return nil, err
-	}
-	defer rows.Close()
-
-	events := make([]Event, 0)
-	for rows.Next() {
-		var evt Event
-		if err := rows.Scan(&evt.ID, &evt.Name); err != nil {
-			log.Printf("Error scanning events: %v", err)
-			continue
-		}
-		events = append(events, evt)
-	}
-
-	return events, nil
-}
\ No newline at end of file
+// GetEvent loads a single event that isn't in the trash
+func GetEvent(db *sql.DB, id string) (Event, error) {
+	var event Event
+	err := db.QueryRow(`SELECT id, name, location, "startTime", "endTime", createdAt FROM "event" WHERE id = $1 AND deletedAt IS NULL`, id).
+		Scan(&event.ID, &event.Name, &event.Location, &event.StartTime, &event.EndTime, &event.CreatedAt)
+	return event, err
+}
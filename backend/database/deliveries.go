@@ -0,0 +1,132 @@
+package database
+
+import (
+	"database/sql"
+)
+
+// Statuses of a delivery
+const (
+	DeliverySent     = "sent"
+	DeliveryRetrying = "retrying"
+	DeliveryFailed   = "failed"
+	DeliveryInvalid  = "invalid" // The token was dead and the device has been removed
+	DeliveryBounced  = "bounced" // The mail server turned the email address down
+)
+
+// Delivery is the outcome of pushing a notification to one device
+type Delivery struct {
+	NotificationID string
+	PushID         int64
+	UserID         string
+	Token          string
+	Channel        string // push or email
+	Status         string
+	ApnsID         string
+	Reason         string
+}
+
+// DeliveryStats sums up how the pushes of a notification went
+type DeliveryStats struct {
+	Total    int            `json:"total"`
+	Sent     int            `json:"sent"`
+	Retrying int            `json:"retrying"`
+	Failed   int            `json:"failed"`
+	Invalid  int            `json:"invalid"`
+	Bounced  int            `json:"bounced"`
+	Emails   int            `json:"emails"` // How many of the total were emails
+	Reasons  map[string]int `json:"reasons"`
+}
+
+// MaskToken hides all but the end of a device token so it can be logged and shown
+func MaskToken(token string) string {
+	if len(token) <= 6 {
+		return "…"
+	}
+	return "…" + token[len(token)-6:]
+}
+
+// RecordDelivery saves the latest outcome for a notification and device. The token is
+// only kept masked, deliveries outlive the device they went to.
+func RecordDelivery(db *sql.DB, delivery Delivery) error {
+	if delivery.NotificationID == "" {
+		return nil
+	}
+
+	if delivery.Channel == "" {
+		delivery.Channel = ChannelPush
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO public.deliveries (notificationId, pushId, deviceId, userId, token, status, apnsId, reason, channel)
+		VALUES ($1, $2, (SELECT id FROM public.devices WHERE token = $3), NULLIF($4, '')::uuid, $5, $6, NULLIF($7, ''), NULLIF($8, ''), $9)
+		ON CONFLICT (pushId) DO UPDATE SET
+			status = EXCLUDED.status, apnsId = EXCLUDED.apnsId, reason = EXCLUDED.reason,
+			attempts = deliveries.attempts + 1, updatedAt = CURRENT_TIMESTAMP
+	`, delivery.NotificationID, delivery.PushID, delivery.Token, delivery.UserID, MaskToken(delivery.Token),
+		delivery.Status, delivery.ApnsID, delivery.Reason, delivery.Channel)
+
+	return err
+}
+
+// RemoveDeadDevice deletes a device whose token the push service says is no longer valid,
+// and drops any pushes still queued for it
+func RemoveDeadDevice(db *sql.DB, token string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM public.devices WHERE token = $1`, token); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE public.push_queue SET status = 'failed', lastError = 'device removed'
+		WHERE token = $1 AND status = 'queued'
+	`, token)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetDeliveryStats counts the deliveries of a notification by status and failure reason
+func GetDeliveryStats(db *sql.DB, notificationID string) (DeliveryStats, error) {
+	stats := DeliveryStats{Reasons: map[string]int{}}
+
+	err := db.QueryRow(`
+		SELECT COUNT(*),
+			COUNT(*) FILTER (WHERE status = 'sent'),
+			COUNT(*) FILTER (WHERE status = 'retrying'),
+			COUNT(*) FILTER (WHERE status = 'failed'),
+			COUNT(*) FILTER (WHERE status = 'invalid'),
+			COUNT(*) FILTER (WHERE status = 'bounced'),
+			COUNT(*) FILTER (WHERE channel = 'email')
+		FROM public.deliveries WHERE notificationId = $1
+	`, notificationID).Scan(&stats.Total, &stats.Sent, &stats.Retrying, &stats.Failed, &stats.Invalid, &stats.Bounced, &stats.Emails)
+	if err != nil {
+		return stats, err
+	}
+
+	rows, err := db.Query(`
+		SELECT reason, COUNT(*) FROM public.deliveries
+		WHERE notificationId = $1 AND reason IS NOT NULL AND status <> 'sent'
+		GROUP BY reason
+	`, notificationID)
+	if err != nil {
+		return stats, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var reason string
+		var count int
+		if err := rows.Scan(&reason, &count); err != nil {
+			return stats, err
+		}
+		stats.Reasons[reason] = count
+	}
+
+	return stats, rows.Err()
+}
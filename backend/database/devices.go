@@ -0,0 +1,95 @@
+package database
+
+import (
+	"database/sql"
+)
+
+// Device types that can be registered for pushes
+const (
+	DeviceIOS     = "ios"
+	DeviceAndroid = "android"
+)
+
+// Device is a phone or browser registered for pushes
+type Device struct {
+	UserID      string
+	DeviceType  string
+	Token       string
+	Environment string
+	WebP256dh   string
+	WebAuth     string
+	AppVersion  string
+	OSVersion   string
+}
+
+/*
+RegisterDevice saves a device for the user, or checks it in again if it is
+already registered. A token registered to someone else moves to this user,
+since it is the same phone with someone else logged in, and the pushes still
+queued for it are dropped so the new owner doesn't get the old one's private
+notifications. The previous owner is returned if the token moved.
+*/
+func RegisterDevice(db *sql.DB, device Device) (string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var previousUserID string
+	err = tx.QueryRow(`
+		WITH previous AS (SELECT userId FROM public.devices WHERE token = $3)
+		INSERT INTO public.devices (userId, deviceType, token, environment, webP256dh, webAuth, appVersion, osVersion, lastSeenAt)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), NULLIF($8, ''), CURRENT_TIMESTAMP)
+		ON CONFLICT (token) DO UPDATE SET userId = EXCLUDED.userId, deviceType = EXCLUDED.deviceType,
+			environment = EXCLUDED.environment, webP256dh = EXCLUDED.webP256dh, webAuth = EXCLUDED.webAuth,
+			appVersion = EXCLUDED.appVersion, osVersion = EXCLUDED.osVersion, lastSeenAt = CURRENT_TIMESTAMP
+		RETURNING COALESCE((SELECT userId::text FROM previous), '')
+	`, device.UserID, device.DeviceType, device.Token, device.Environment, device.WebP256dh, device.WebAuth,
+		device.AppVersion, device.OSVersion).Scan(&previousUserID)
+	if err != nil {
+		return "", err
+	}
+
+	if previousUserID != "" && previousUserID != device.UserID {
+		_, err = tx.Exec(`
+			UPDATE public.push_queue SET status = 'failed', lastError = 'device changed owner'
+			WHERE token = $1 AND status = 'queued' AND userId IS DISTINCT FROM $2::uuid
+		`, device.Token, device.UserID)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		previousUserID = ""
+	}
+
+	return previousUserID, tx.Commit()
+}
+
+// UnregisterDevice removes the user's device when they log out, returning false if they
+// have no device with the token
+func UnregisterDevice(db *sql.DB, userID string, token string) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`DELETE FROM public.devices WHERE token = $1 AND userId = $2`, token, userID)
+	if err != nil {
+		return false, err
+	}
+	if removed, _ := res.RowsAffected(); removed == 0 {
+		return false, nil
+	}
+
+	_, err = tx.Exec(`
+		UPDATE public.push_queue SET status = 'failed', lastError = 'device logged out'
+		WHERE token = $1 AND status = 'queued'
+	`, token)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
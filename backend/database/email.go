@@ -0,0 +1,99 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/mail"
+	"strings"
+)
+
+// Channels a notification can be sent through
+const (
+	ChannelPush  = "push"
+	ChannelEmail = "email"
+)
+
+// DeviceEmail is the device type of queued emails, the token is the address
+const DeviceEmail = "email"
+
+// ParseEmailAddress returns the bare address if it is a single valid email address. Anything
+// with a line break is refused so an address can't add headers to the email it is put in.
+func ParseEmailAddress(address string) (string, bool) {
+	if strings.ContainsAny(address, "\r\n") {
+		return "", false
+	}
+
+	parsed, err := mail.ParseAddress(address)
+	if err != nil {
+		return "", false
+	}
+
+	return parsed.Address, true
+}
+
+// ValidateChannels checks every channel is known, no channels means push
+func ValidateChannels(channels []string) error {
+	for _, channel := range channels {
+		if channel != ChannelPush && channel != ChannelEmail {
+			return fmt.Errorf("unknown channel %q, must be push or email", channel)
+		}
+	}
+
+	return nil
+}
+
+// HasChannel reports whether the notification goes out through the channel
+func (n Notification) HasChannel(channel string) bool {
+	if len(n.Channels) == 0 {
+		return channel == ChannelPush
+	}
+
+	for _, c := range n.Channels {
+		if c == channel {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetEmailRecipients returns the email addresses of the users the targets reach that
+// haven't muted the type. Quiet hours don't apply to email. Emergencies go to everyone.
+func GetEmailRecipients(db *sql.DB, targets []Target, notifType string) ([]DeviceRecipient, error) {
+	param, err := targetsParam(targets)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT u.id::text, u.email, '`+DeviceEmail+`', ''
+		FROM public.users u
+		WHERE COALESCE(u.email, '') <> '' AND `+audienceMatch("$1::jsonb")+`
+			AND ($2 = '`+TypeEmergency+`' OR NOT EXISTS (
+				SELECT 1 FROM public.user_preferences p WHERE p.userId = u.id AND $2 = ANY(p.mutedTypes)
+			))
+	`, param, notifType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recipients, err := scanRecipients(rows)
+	if err != nil {
+		return nil, err
+	}
+
+	valid := make([]DeviceRecipient, 0, len(recipients))
+	for _, recipient := range recipients {
+		address, ok := ParseEmailAddress(recipient.Token)
+		if !ok {
+			log.Printf("Not emailing user %s, their address isn't valid", recipient.UserID)
+			continue
+		}
+		recipient.Token = address
+		valid = append(valid, recipient)
+	}
+
+	return valid, nil
+}
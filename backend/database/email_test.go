@@ -0,0 +1,42 @@
+package database
+
+import "testing"
+
+func TestParseEmailAddress(t *testing.T) {
+	valid := map[string]string{
+		"sam@example.com":              "sam@example.com",
+		"sam.lee+tsa@school.k12.nc.us": "sam.lee+tsa@school.k12.nc.us",
+		"  sam@example.com  ":          "sam@example.com",
+		"Sam Lee <sam@example.com>":    "sam@example.com",
+		`"Lee, Sam" <sam@example.com>`: "sam@example.com",
+	}
+	for address, want := range valid {
+		got, ok := ParseEmailAddress(address)
+		if !ok {
+			t.Errorf("ParseEmailAddress(%q) was refused, want %q", address, want)
+			continue
+		}
+		if got != want {
+			t.Errorf("ParseEmailAddress(%q) = %q, want the bare address %q", address, got, want)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"sam",
+		"sam@",
+		"@example.com",
+		"sam@example.com\r\nBcc: everyone@example.com",
+		"sam@example.com\nBcc: everyone@example.com",
+		"sam@example.com\r",
+		"Sam\r\n <sam@example.com>",
+		"sam@example.com, alex@example.com",
+		"Sam <sam@example.com",
+		"=?utf-8?q?Sam=0D=0ABcc:_x@evil.com?= <sam@example.com>",
+	}
+	for _, address := range invalid {
+		if got, ok := ParseEmailAddress(address); ok {
+			t.Errorf("ParseEmailAddress(%q) = %q, should have been refused", address, got)
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+)
+
+// TypeEmergency is the notification type for weather, evacuations and lockdowns. They
+// skip approval, are sent as critical alerts and stay pinned in the app until cleared.
+const TypeEmergency = "emergency"
+
+var ErrNotActiveEmergency = errors.New("notification is not an active emergency")
+
+// CanSendEmergencies reports whether the api key is one of the emergency senders
+func CanSendEmergencies(db *sql.DB, keyID string) (bool, error) {
+	if keyID == "" {
+		return false, nil
+	}
+
+	var allowed bool
+	err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM public.emergency_senders WHERE apiKeyId::text = $1)`, keyID).Scan(&allowed)
+	return allowed, err
+}
+
+// IsActiveEmergency reports whether the notification is a published emergency that hasn't been cleared
+func (n Notification) IsActiveEmergency() bool {
+	return n.Type == TypeEmergency && n.Published && n.ClearedAt == nil
+}
+
+// ClearEmergency marks an emergency as over so it is no longer pinned
+func ClearEmergency(db *sql.DB, id string) (Notification, error) {
+	notif, err := scanNotification(db.QueryRow(`
+		UPDATE public.notifications SET clearedAt = CURRENT_TIMESTAMP
+		WHERE id = $1 AND type = '`+TypeEmergency+`' AND clearedAt IS NULL AND deletedAt IS NULL
+		RETURNING `+notificationColumns, id))
+
+	if err == sql.ErrNoRows {
+		return notif, ErrNotActiveEmergency
+	}
+
+	return notif, err
+}
+
+// GetActiveEmergencies returns the emergencies still in effect from the cache, newest first
+func GetActiveEmergencies() ([]Notification, error) {
+	notifications, err := GetNotificationsCache()
+	if err != nil {
+		return nil, err
+	}
+
+	emergencies := make([]Notification, 0)
+	for _, notif := range notifications {
+		if notif.IsActiveEmergency() {
+			emergencies = append(emergencies, notif)
+		}
+	}
+
+	sort.SliceStable(emergencies, func(i, j int) bool {
+		return emergencies[i].Date.After(emergencies[j].Date)
+	})
+	return emergencies, nil
+}
@@ -0,0 +1,111 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/google/uuid"
+)
+
+// Link is what a notification opens in the app when it is tapped
+type Link struct {
+	Type string `json:"type"`          // event, agenda, resource or url
+	ID   string `json:"id,omitempty"`  // The event or agenda item id, or the name of the resource (like "map")
+	URL  string `json:"url,omitempty"` // For url links
+}
+
+const (
+	LinkEvent    = "event"
+	LinkAgenda   = "agenda"
+	LinkResource = "resource"
+	LinkURL      = "url"
+)
+
+// Action categories a notification can have, the app registers the buttons for each
+const (
+	CategoryAddToAgenda = "ADD_TO_AGENDA"
+	CategoryViewEvent   = "VIEW_EVENT"
+	CategoryOpenLink    = "OPEN_LINK"
+)
+
+var ErrInvalidLink = errors.New("invalid link")
+
+// CheckRichContent makes sure the link points at something that exists, the image is a
+// url and the category is one the app knows, along with the kind of link it needs
+func CheckRichContent(db *sql.DB, notif Notification) error {
+	if notif.Link != nil {
+		if err := checkLink(db, *notif.Link); err != nil {
+			return err
+		}
+	}
+
+	if notif.ImageURL != "" && !isWebURL(notif.ImageURL) {
+		return fmt.Errorf("%w: imageUrl has to be an http or https url", ErrInvalidLink)
+	}
+
+	switch notif.Category {
+	case "":
+	case CategoryAddToAgenda, CategoryViewEvent:
+		if notif.Link == nil || notif.Link.Type != LinkEvent {
+			return fmt.Errorf("%w: the %s category needs an event link", ErrInvalidLink, notif.Category)
+		}
+	case CategoryOpenLink:
+		if notif.Link == nil {
+			return fmt.Errorf("%w: the %s category needs a link", ErrInvalidLink, notif.Category)
+		}
+	default:
+		return fmt.Errorf("%w: unknown category %q", ErrInvalidLink, notif.Category)
+	}
+
+	return nil
+}
+
+func checkLink(db *sql.DB, link Link) error {
+	switch link.Type {
+	case LinkEvent, LinkAgenda:
+		if _, err := uuid.Parse(link.ID); err != nil {
+			return fmt.Errorf("%w: %s links need a valid id", ErrInvalidLink, link.Type)
+		}
+
+		var err error
+		if link.Type == LinkEvent {
+			_, err = GetEvent(db, link.ID)
+		} else {
+			_, err = GetAgendaItem(db, link.ID)
+		}
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("%w: %s %s not found", ErrInvalidLink, link.Type, link.ID)
+		}
+		return err
+	case LinkResource:
+		if link.ID == "" {
+			return fmt.Errorf("%w: resource links need the name of the resource", ErrInvalidLink)
+		}
+	case LinkURL:
+		if !isWebURL(link.URL) {
+			return fmt.Errorf("%w: url links need an http or https url", ErrInvalidLink)
+		}
+	default:
+		return fmt.Errorf("%w: unknown type %q", ErrInvalidLink, link.Type)
+	}
+
+	return nil
+}
+
+func isWebURL(raw string) bool {
+	parsed, err := url.Parse(raw)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != ""
+}
+
+// linkParam is the link as the jsonb the queries take, NULL if there isn't one
+func linkParam(link *Link) (any, error) {
+	if link == nil {
+		return nil, nil
+	}
+
+	raw, err := json.Marshal(link)
+	return string(raw), err
+}
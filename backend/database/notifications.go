@@ -0,0 +1,122 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/lib/pq"
+)
+
+// notificationColumns is the select list that scanNotification expects
+const notificationColumns = `id, title, description, date, createdAt, published, private, COALESCE(type, 'general'), targets,
+	publishAt, status, COALESCE(createdBy, ''), COALESCE(eventId::text, ''), clearedAt,
+	link, COALESCE(imageUrl, ''), COALESCE(category, ''), retractedAt, COALESCE(correctsId::text, ''), channels`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanNotification scans a row selected with notificationColumns
+func scanNotification(row rowScanner) (Notification, error) {
+	var notif Notification
+	var targets, link []byte
+	var publishAt, clearedAt, retractedAt sql.NullTime
+	err := row.Scan(&notif.ID, &notif.Title, &notif.Description, &notif.Date, &notif.CreatedAt, &notif.Published, &notif.Private, &notif.Type, &targets,
+		&publishAt, &notif.Status, &notif.CreatedBy, &notif.EventID, &clearedAt,
+		&link, &notif.ImageURL, &notif.Category, &retractedAt, &notif.CorrectsID, pq.Array(&notif.Channels))
+	if err != nil {
+		return notif, err
+	}
+
+	notif.Targets = make([]Target, 0)
+	if len(targets) > 0 {
+		if err := json.Unmarshal(targets, &notif.Targets); err != nil {
+			return notif, err
+		}
+	}
+	if len(link) > 0 {
+		err = json.Unmarshal(link, &notif.Link)
+	}
+	notif.PublishAt = TimePtr(publishAt)
+	notif.ClearedAt = TimePtr(clearedAt)
+	notif.RetractedAt = TimePtr(retractedAt)
+	return notif, err
+}
+
+// scanNotifications scans every row selected with notificationColumns
+func scanNotifications(rows *sql.Rows) ([]Notification, error) {
+	defer rows.Close()
+
+	notifications := make([]Notification, 0)
+	for rows.Next() {
+		notif, err := scanNotification(rows)
+		if err != nil {
+			return notifications, err
+		}
+		notifications = append(notifications, notif)
+	}
+
+	return notifications, rows.Err()
+}
+
+// GetNotification loads a single notification that isn't in the trash
+func GetNotification(db *sql.DB, id string) (Notification, error) {
+	return scanNotification(db.QueryRow(`SELECT `+notificationColumns+` FROM "notifications" WHERE id = $1 AND deletedAt IS NULL`, id))
+}
+
+// InsertNotification saves a new notification, filling in its ID and createdAt
+func InsertNotification(db *sql.DB, notif *Notification, submittedByKeyID string) error {
+	if notif.Type == "" {
+		notif.Type = "general"
+	}
+	if len(notif.Channels) == 0 {
+		notif.Channels = []string{ChannelPush}
+	}
+	targets, err := targetsParam(notif.Targets)
+	if err != nil {
+		return err
+	}
+	link, err := linkParam(notif.Link)
+	if err != nil {
+		return err
+	}
+
+	return db.QueryRow(`
+		INSERT INTO "notifications" (title, description, date, published, private, type, targets, publishAt, status, submittedByKeyId, createdBy, eventId,
+			link, imageUrl, category, correctsId, channels)
+		VALUES ($1, $2, $3, $4, $5, $6, $7::jsonb, $8, $9, NULLIF($10, '')::uuid, $11, NULLIF($12, '')::uuid, $13::jsonb, NULLIF($14, ''), NULLIF($15, ''),
+			NULLIF($16, '')::uuid, $17)
+		RETURNING id, createdAt
+	`, notif.Title, notif.Description, notif.Date, notif.Published, notif.Private, notif.Type, targets, notif.PublishAt,
+		notif.Status, submittedByKeyID, notif.CreatedBy, notif.EventID, link, notif.ImageURL, notif.Category, notif.CorrectsID,
+		pq.Array(notif.Channels)).Scan(&notif.ID, &notif.CreatedAt)
+}
+
+// UpdateNotification saves the changes to an existing notification
+func UpdateNotification(db *sql.DB, notif *Notification, submittedByKeyID string) error {
+	if notif.Type == "" {
+		notif.Type = "general"
+	}
+	if len(notif.Channels) == 0 {
+		notif.Channels = []string{ChannelPush}
+	}
+	targets, err := targetsParam(notif.Targets)
+	if err != nil {
+		return err
+	}
+	link, err := linkParam(notif.Link)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		UPDATE "notifications" SET title=$1, description=$2, date=$3, published=$4, private=$5, type=$6, targets=$7::jsonb,
+			publishAt=$8, status=$9, submittedByKeyId=NULLIF($10, '')::uuid, eventId=NULLIF($11, '')::uuid,
+			link=$13::jsonb, imageUrl=NULLIF($14, ''), category=NULLIF($15, ''), channels=$16
+		WHERE id=$12
+	`, notif.Title, notif.Description, notif.Date, notif.Published, notif.Private, notif.Type, targets,
+		notif.PublishAt, notif.Status, submittedByKeyID, notif.EventID, notif.ID, link, notif.ImageURL, notif.Category,
+		pq.Array(notif.Channels))
+
+	return err
+}
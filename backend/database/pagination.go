@@ -0,0 +1,184 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+const (
+	DefaultPageLimit = 20
+	MaxPageLimit     = 100
+)
+
+// ListOptions describes a single page request for the admin list endpoints.
+// Sort and Filters use the public (json) field names, which are mapped onto
+// columns by each list function so nothing from the request reaches the SQL.
+type ListOptions struct {
+	Limit   int
+	Cursor  string
+	Sort    string
+	Desc    bool
+	Search  string
+	Filters map[string]string
+}
+
+// Page is one page of results, the total number of matching rows and the
+// cursor to pass back in to get the next page
+type Page[T any] struct {
+	Items      []T    `json:"items"`
+	Total      int    `json:"total"`
+	NextCursor string `json:"nextCursor,omitempty"`
+}
+
+var (
+	ErrInvalidListOptions = errors.New("invalid list options")
+	ErrInvalidCursor      = fmt.Errorf("%w: bad cursor", ErrInvalidListOptions)
+)
+
+// listQuery is the description of a table that can be paged through
+type listQuery struct {
+	from        string            // everything after FROM, including joins
+	columns     string            // the select list
+	where       []string          // conditions that always apply
+	sortable    map[string]string // public sort key -> column
+	filterable  map[string]string // public filter key -> column
+	defaultSort string            // public sort key used when none is given
+	tiebreaker  string            // unique column appended to every ORDER BY
+}
+
+// EncodeCursor turns an offset into the opaque cursor handed to clients
+func EncodeCursor(offset int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte("o:" + strconv.Itoa(offset)))
+}
+
+// DecodeCursor turns a cursor back into an offset, an empty cursor is the first page
+func DecodeCursor(cursor string) (int, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || !strings.HasPrefix(string(raw), "o:") {
+		return 0, ErrInvalidCursor
+	}
+
+	offset, err := strconv.Atoi(strings.TrimPrefix(string(raw), "o:"))
+	if err != nil || offset < 0 {
+		return 0, ErrInvalidCursor
+	}
+
+	return offset, nil
+}
+
+// runList counts and fetches one page of the list query. Extra conditions (like the
+// search term) are passed in with their arguments already numbered from $1.
+func runList[T any](db *sql.DB, q listQuery, opts ListOptions, extra []string, args []any, scan func(*sql.Rows) (T, error)) (Page[T], error) {
+	page := Page[T]{Items: make([]T, 0)}
+
+	offset, err := DecodeCursor(opts.Cursor)
+	if err != nil {
+		return page, err
+	}
+	limit := normalizeLimit(opts.Limit)
+
+	where := append(append([]string{}, q.where...), extra...)
+
+	// Sort the filter keys so the generated query is stable
+	keys := make([]string, 0, len(opts.Filters))
+	for key := range opts.Filters {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		column, ok := q.filterable[key]
+		if !ok {
+			return page, fmt.Errorf("%w: unknown filter %q", ErrInvalidListOptions, key)
+		}
+		args = append(args, opts.Filters[key])
+		// Compared against the column as it is so its index can be used, postgres
+		// turns the value into the column's type
+		where = append(where, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	whereClause := ""
+	if len(where) > 0 {
+		whereClause = " WHERE " + strings.Join(where, " AND ")
+	}
+
+	sortKey := opts.Sort
+	if sortKey == "" {
+		sortKey = q.defaultSort
+	}
+	sortColumn, ok := q.sortable[sortKey]
+	if !ok {
+		return page, fmt.Errorf("%w: unknown sort %q", ErrInvalidListOptions, opts.Sort)
+	}
+	direction := "ASC"
+	if opts.Desc {
+		direction = "DESC"
+	}
+
+	err = db.QueryRow("SELECT COUNT(*) FROM "+q.from+whereClause, args...).Scan(&page.Total)
+	if err != nil {
+		return page, filterValueError(err)
+	}
+
+	pageQuery := fmt.Sprintf("SELECT %s FROM %s%s ORDER BY %s %s, %s LIMIT $%d OFFSET $%d",
+		q.columns, q.from, whereClause, sortColumn, direction, q.tiebreaker, len(args)+1, len(args)+2)
+	rows, err := db.Query(pageQuery, append(args, limit, offset)...)
+	if err != nil {
+		return page, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		item, err := scan(rows)
+		if err != nil {
+			return page, err
+		}
+		page.Items = append(page.Items, item)
+	}
+
+	if err := rows.Err(); err != nil {
+		return page, err
+	}
+
+	page.NextCursor = nextCursor(offset, len(page.Items), page.Total)
+	return page, nil
+}
+
+// filterValueError turns postgres refusing a filter value for the column's type (like
+// schoolId=abc) into a bad request
+func filterValueError(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && (pqErr.Code == "22P02" || pqErr.Code == "22003") {
+		return fmt.Errorf("%w: bad filter value", ErrInvalidListOptions)
+	}
+	return err
+}
+
+// normalizeLimit clamps the requested page size
+func normalizeLimit(limit int) int {
+	if limit <= 0 {
+		return DefaultPageLimit
+	}
+	if limit > MaxPageLimit {
+		return MaxPageLimit
+	}
+	return limit
+}
+
+// nextCursor returns the cursor for the page after the one starting at offset, if there is one
+func nextCursor(offset, count, total int) string {
+	if offset+count >= total {
+		return ""
+	}
+	return EncodeCursor(offset + count)
+}
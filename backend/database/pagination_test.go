@@ -0,0 +1,94 @@
+package database
+
+import (
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	for _, offset := range []int{0, 1, 20, 99, 12345} {
+		cursor := EncodeCursor(offset)
+
+		got, err := DecodeCursor(cursor)
+		if err != nil {
+			t.Fatalf("DecodeCursor(EncodeCursor(%d)) failed: %v", offset, err)
+		}
+		if got != offset {
+			t.Errorf("DecodeCursor(EncodeCursor(%d)) = %d", offset, got)
+		}
+	}
+}
+
+func TestDecodeEmptyCursor(t *testing.T) {
+	offset, err := DecodeCursor("")
+	if err != nil || offset != 0 {
+		t.Errorf(`DecodeCursor("") = %d, %v, want the first page`, offset, err)
+	}
+}
+
+func TestDecodeBadCursor(t *testing.T) {
+	encode := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+
+	cursors := map[string]string{
+		"not base64":       "%%%",
+		"missing prefix":   encode("20"),
+		"wrong prefix":     encode("p:20"),
+		"not a number":     encode("o:twenty"),
+		"negative offset":  encode("o:-20"),
+		"padded base64":    base64.URLEncoding.EncodeToString([]byte("o:25")),
+		"raw offset":       "20",
+		"empty offset":     encode("o:"),
+		"trailing garbage": encode("o:20;DROP"),
+	}
+
+	for name, cursor := range cursors {
+		t.Run(name, func(t *testing.T) {
+			_, err := DecodeCursor(cursor)
+			if !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("DecodeCursor(%q) = %v, want ErrInvalidCursor", cursor, err)
+			}
+			if !errors.Is(err, ErrInvalidListOptions) {
+				t.Errorf("DecodeCursor(%q) should be an ErrInvalidListOptions so it's a 400", cursor)
+			}
+		})
+	}
+}
+
+func TestNextCursor(t *testing.T) {
+	tests := []struct {
+		name                 string
+		offset, count, total int
+		want                 string
+	}{
+		{"more after the first page", 0, 20, 45, EncodeCursor(20)},
+		{"more after a middle page", 20, 20, 45, EncodeCursor(40)},
+		{"last page", 40, 5, 45, ""},
+		{"exactly full last page", 20, 20, 40, ""},
+		{"empty list", 0, 0, 0, ""},
+	}
+
+	for _, test := range tests {
+		if got := nextCursor(test.offset, test.count, test.total); got != test.want {
+			t.Errorf("%s: nextCursor(%d, %d, %d) = %q, want %q", test.name, test.offset, test.count, test.total, got, test.want)
+		}
+	}
+}
+
+func TestNormalizeLimit(t *testing.T) {
+	tests := map[int]int{
+		-1:               DefaultPageLimit,
+		0:                DefaultPageLimit,
+		1:                1,
+		MaxPageLimit:     MaxPageLimit,
+		MaxPageLimit + 1: MaxPageLimit,
+	}
+
+	for limit, want := range tests {
+		if got := normalizeLimit(limit); got != want {
+			t.Errorf("normalizeLimit(%d) = %d, want %d", limit, got, want)
+		}
+	}
+}
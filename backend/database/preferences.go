@@ -0,0 +1,175 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Bounds on how long before an item starts a reminder can be sent
+const (
+	DefaultReminderMinutes = 15
+	MaxReminderMinutes     = 24 * 60
+)
+
+// MutableTypes are the notification types a user can turn pushes off for. Emergencies
+// aren't one of them, they always go through.
+var MutableTypes = []string{"general", "event", "chapter"}
+
+var ErrInvalidPreferences = errors.New("invalid preferences")
+
+// QuietHours is a time of day, in the conference's timezone, when the user doesn't
+// want pushes. It can wrap past midnight, like 22:00 to 07:00.
+type QuietHours struct {
+	Start string `json:"start"` // HH:MM
+	End   string `json:"end"`   // HH:MM
+}
+
+// Preferences are a user's settings, users that never changed them get the defaults
+type Preferences struct {
+	RemindersEnabled bool        `json:"remindersEnabled"`
+	ReminderMinutes  int         `json:"reminderMinutes"`
+	MutedTypes       []string    `json:"mutedTypes"`
+	QuietHours       *QuietHours `json:"quietHours"`
+}
+
+// DefaultPreferences are the settings of a user without a user_preferences row
+func DefaultPreferences() Preferences {
+	return Preferences{ReminderMinutes: DefaultReminderMinutes, MutedTypes: []string{}}
+}
+
+// Validate checks the settings are in range
+func (p Preferences) Validate() error {
+	if p.ReminderMinutes < 1 || p.ReminderMinutes > MaxReminderMinutes {
+		return fmt.Errorf("%w: reminderMinutes must be between 1 and %d", ErrInvalidPreferences, MaxReminderMinutes)
+	}
+
+	for _, muted := range p.MutedTypes {
+		if muted == TypeEmergency {
+			return fmt.Errorf("%w: emergency alerts can't be muted", ErrInvalidPreferences)
+		}
+		if !isMutable(muted) {
+			return fmt.Errorf("%w: unknown notification type %q", ErrInvalidPreferences, muted)
+		}
+	}
+
+	if p.QuietHours != nil {
+		for _, clock := range []string{p.QuietHours.Start, p.QuietHours.End} {
+			if _, err := time.Parse("15:04", clock); err != nil {
+				return fmt.Errorf("%w: quiet hours must be given as HH:MM", ErrInvalidPreferences)
+			}
+		}
+		if p.QuietHours.Start == p.QuietHours.End {
+			return fmt.Errorf("%w: quiet hours can't start and end at the same time", ErrInvalidPreferences)
+		}
+	}
+
+	return nil
+}
+
+func isMutable(notifType string) bool {
+	for _, mutable := range MutableTypes {
+		if notifType == mutable {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetPreferences returns the user's settings
+func GetPreferences(db *sql.DB, userID string) (Preferences, error) {
+	prefs := DefaultPreferences()
+	var quietStart, quietEnd sql.NullString
+	err := db.QueryRow(`
+		SELECT remindersEnabled, reminderMinutes, mutedTypes,
+			to_char(quietHoursStart, 'HH24:MI'), to_char(quietHoursEnd, 'HH24:MI')
+		FROM public.user_preferences WHERE userId = $1
+	`, userID).Scan(&prefs.RemindersEnabled, &prefs.ReminderMinutes, pq.Array(&prefs.MutedTypes), &quietStart, &quietEnd)
+	if err == sql.ErrNoRows {
+		return DefaultPreferences(), nil
+	}
+	if err != nil {
+		return prefs, err
+	}
+
+	if prefs.MutedTypes == nil {
+		prefs.MutedTypes = []string{}
+	}
+	if quietStart.Valid && quietEnd.Valid {
+		prefs.QuietHours = &QuietHours{Start: quietStart.String, End: quietEnd.String}
+	}
+
+	return prefs, nil
+}
+
+// SavePreferences stores the user's settings
+func SavePreferences(db *sql.DB, userID string, prefs Preferences) error {
+	var quietStart, quietEnd sql.NullString
+	if prefs.QuietHours != nil {
+		quietStart = sql.NullString{String: prefs.QuietHours.Start, Valid: true}
+		quietEnd = sql.NullString{String: prefs.QuietHours.End, Valid: true}
+	}
+	if prefs.MutedTypes == nil {
+		prefs.MutedTypes = []string{}
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO public.user_preferences (userId, remindersEnabled, reminderMinutes, mutedTypes, quietHoursStart, quietHoursEnd)
+		VALUES ($1, $2, $3, $4, $5::time, $6::time)
+		ON CONFLICT (userId) DO UPDATE SET remindersEnabled = EXCLUDED.remindersEnabled,
+			reminderMinutes = EXCLUDED.reminderMinutes, mutedTypes = EXCLUDED.mutedTypes,
+			quietHoursStart = EXCLUDED.quietHoursStart, quietHoursEnd = EXCLUDED.quietHoursEnd,
+			updatedAt = CURRENT_TIMESTAMP
+	`, userID, prefs.RemindersEnabled, prefs.ReminderMinutes, pq.Array(prefs.MutedTypes), quietStart, quietEnd)
+
+	return err
+}
+
+/*
+pushWanted is the condition for the user (u) wanting a push of the type in
+typeExpr right now, going by their preferences. Devices without a user and
+users without preferences get everything. Quiet hours are in the agenda's
+timezone, since that is where the conference is.
+*/
+func pushWanted(typeExpr string, tzExpr string) string {
+	return `(u.id IS NULL OR NOT EXISTS (
+		SELECT 1 FROM public.user_preferences p
+		WHERE p.userId = u.id AND (
+			` + typeExpr + ` = ANY(p.mutedTypes)
+			OR (p.quietHoursStart < p.quietHoursEnd
+				AND (CURRENT_TIMESTAMP AT TIME ZONE ` + tzExpr + `)::time >= p.quietHoursStart
+				AND (CURRENT_TIMESTAMP AT TIME ZONE ` + tzExpr + `)::time < p.quietHoursEnd)
+			OR (p.quietHoursStart > p.quietHoursEnd
+				AND ((CURRENT_TIMESTAMP AT TIME ZONE ` + tzExpr + `)::time >= p.quietHoursStart
+					OR (CURRENT_TIMESTAMP AT TIME ZONE ` + tzExpr + `)::time < p.quietHoursEnd))
+		)
+	))`
+}
+
+// GetPushDevices returns the devices the targets reach whose users want a push of the
+// type right now. Emergencies go to every device regardless.
+func GetPushDevices(db *sql.DB, targets []Target, notifType string) ([]DeviceRecipient, error) {
+	if notifType == TypeEmergency {
+		return GetAudienceDevices(db, targets)
+	}
+
+	param, err := targetsParam(targets)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`
+		SELECT DISTINCT COALESCE(u.id::text, ''), d.token, d.deviceType, d.environment
+		FROM public.devices d LEFT JOIN public.users u ON u.id = d.userId
+		WHERE `+audienceMatch("$1::jsonb")+` AND `+pushWanted("$2", "$3"), param, notifType, agendaTimezone())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return scanRecipients(rows)
+}
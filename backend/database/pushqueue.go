@@ -0,0 +1,156 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Statuses of a push in the send queue
+const (
+	PushQueued  = "queued"
+	PushSending = "sending"
+	PushSent    = "sent"
+	PushFailed  = "failed"
+)
+
+// PriorityEmergency is the queue priority of emergencies, they go before everything else
+const PriorityEmergency = 10
+
+// pushLockTimeout is how long a push can be claimed before another worker takes it
+// over, in case the replica sending it died
+const pushLockTimeout = 5 * time.Minute
+
+// Push is one message waiting in the send queue for one device
+type Push struct {
+	ID             int64           `json:"id"`
+	NotificationID string          `json:"notificationId,omitempty"`
+	UserID         string          `json:"userId,omitempty"`
+	Token          string          `json:"-"`
+	DeviceType     string          `json:"deviceType"`
+	Environment    string          `json:"environment"`
+	Priority       int             `json:"priority"`
+	Message        json.RawMessage `json:"message"`
+	Attempts       int             `json:"attempts"`
+}
+
+// PushProgress is how far through sending a notification is
+type PushProgress struct {
+	Total   int `json:"total"`
+	Queued  int `json:"queued"`
+	Sending int `json:"sending"`
+	Sent    int `json:"sent"`
+	Failed  int `json:"failed"`
+}
+
+// EnqueuePushes adds the pushes to the send queue in one statement
+func EnqueuePushes(db *sql.DB, pushes []Push) error {
+	if len(pushes) == 0 {
+		return nil
+	}
+
+	notificationIDs := make([]string, len(pushes))
+	userIDs := make([]string, len(pushes))
+	tokens := make([]string, len(pushes))
+	deviceTypes := make([]string, len(pushes))
+	environments := make([]string, len(pushes))
+	priorities := make([]int64, len(pushes))
+	messages := make([]string, len(pushes))
+	for i, push := range pushes {
+		notificationIDs[i] = push.NotificationID
+		userIDs[i] = push.UserID
+		tokens[i] = push.Token
+		deviceTypes[i] = push.DeviceType
+		environments[i] = push.Environment
+		priorities[i] = int64(push.Priority)
+		messages[i] = string(push.Message)
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO public.push_queue (notificationId, userId, token, deviceType, environment, priority, message)
+		SELECT NULLIF(n, '')::uuid, NULLIF(u, '')::uuid, t, d, COALESCE(NULLIF(e, ''), 'production'), p, m::jsonb
+		FROM unnest($1::text[], $2::text[], $3::text[], $4::text[], $5::text[], $6::int[], $7::text[]) AS q(n, u, t, d, e, p, m)
+	`, pq.Array(notificationIDs), pq.Array(userIDs), pq.Array(tokens), pq.Array(deviceTypes), pq.Array(environments), pq.Array(priorities), pq.Array(messages))
+
+	return err
+}
+
+// ClaimPushes takes up to limit pushes that are due, highest priority first. Workers on
+// every replica can claim at once, SKIP LOCKED keeps them from getting the same rows.
+func ClaimPushes(db *sql.DB, limit int) ([]Push, error) {
+	rows, err := db.Query(`
+		UPDATE public.push_queue SET status = 'sending', lockedAt = CURRENT_TIMESTAMP, attempts = attempts + 1
+		WHERE id IN (
+			SELECT id FROM public.push_queue
+			WHERE (status = 'queued' AND nextAttemptAt <= CURRENT_TIMESTAMP)
+				OR (status = 'sending' AND lockedAt < CURRENT_TIMESTAMP - $2 * INTERVAL '1 second')
+			ORDER BY priority DESC, id
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, COALESCE(notificationId::text, ''), COALESCE(userId::text, ''), token, deviceType, environment, priority, message, attempts
+	`, limit, pushLockTimeout.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pushes := make([]Push, 0)
+	for rows.Next() {
+		var push Push
+		if err := rows.Scan(&push.ID, &push.NotificationID, &push.UserID, &push.Token, &push.DeviceType, &push.Environment, &push.Priority, &push.Message, &push.Attempts); err != nil {
+			return pushes, err
+		}
+		pushes = append(pushes, push)
+	}
+
+	return pushes, rows.Err()
+}
+
+// MarkPushSent records that a push was accepted
+func MarkPushSent(db *sql.DB, id int64) error {
+	_, err := db.Exec(`UPDATE public.push_queue SET status = 'sent', sentAt = CURRENT_TIMESTAMP, lastError = NULL WHERE id = $1`, id)
+	return err
+}
+
+// RetryPush puts a push back in the queue to be tried again after the delay
+func RetryPush(db *sql.DB, id int64, delay time.Duration, reason string) error {
+	_, err := db.Exec(`
+		UPDATE public.push_queue SET status = 'queued', nextAttemptAt = CURRENT_TIMESTAMP + $2 * INTERVAL '1 second', lastError = $3
+		WHERE id = $1
+	`, id, delay.Seconds(), reason)
+	return err
+}
+
+// FailPush gives up on a push
+func FailPush(db *sql.DB, id int64, reason string) error {
+	_, err := db.Exec(`UPDATE public.push_queue SET status = 'failed', lastError = $2 WHERE id = $1`, id, reason)
+	return err
+}
+
+// GetPushProgress counts the pushes of a notification by status
+func GetPushProgress(db *sql.DB, notificationID string) (PushProgress, error) {
+	var progress PushProgress
+	err := db.QueryRow(`
+		SELECT COUNT(*),
+			COUNT(*) FILTER (WHERE status = 'queued'),
+			COUNT(*) FILTER (WHERE status = 'sending'),
+			COUNT(*) FILTER (WHERE status = 'sent'),
+			COUNT(*) FILTER (WHERE status = 'failed')
+		FROM public.push_queue WHERE notificationId = $1
+	`, notificationID).Scan(&progress.Total, &progress.Queued, &progress.Sending, &progress.Sent, &progress.Failed)
+
+	return progress, err
+}
+
+// PrunePushQueue removes finished pushes older than the cutoff
+func PrunePushQueue(db *sql.DB, cutoff time.Time) (int64, error) {
+	res, err := db.Exec(`DELETE FROM public.push_queue WHERE status IN ('sent', 'failed') AND createdAt < $1`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
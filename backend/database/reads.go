@@ -0,0 +1,134 @@
+package database
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// ReadStats is how many of the people a notification is for have read it
+type ReadStats struct {
+	Users int     `json:"users"`
+	Read  int     `json:"read"`
+	Rate  float64 `json:"rate"`
+}
+
+// unreadCondition is the condition for the notification (n) being one the user (u) can
+// see and hasn't read
+var unreadCondition = `n.published = true AND n.deletedAt IS NULL AND ` + audienceMatch("n.targets") + `
+	AND NOT EXISTS (SELECT 1 FROM public.notification_reads r WHERE r.userId = u.id AND r.notificationId = n.id)`
+
+// MarkNotificationRead records the user reading a notification, returning false if it
+// isn't one they can see
+func MarkNotificationRead(db *sql.DB, userID string, notificationID string) (bool, error) {
+	var visible bool
+	err := db.QueryRow(`
+		SELECT EXISTS(
+			SELECT 1 FROM public.notifications n, public.users u
+			WHERE u.id = $1 AND n.id = $2 AND n.published = true AND n.deletedAt IS NULL AND `+audienceMatch("n.targets")+`
+		)
+	`, userID, notificationID).Scan(&visible)
+	if err != nil || !visible {
+		return false, err
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO public.notification_reads (userId, notificationId) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, userID, notificationID)
+
+	return err == nil, err
+}
+
+// MarkAllNotificationsRead records the user reading every notification they can see
+func MarkAllNotificationsRead(db *sql.DB, userID string) (int64, error) {
+	res, err := db.Exec(`
+		INSERT INTO public.notification_reads (userId, notificationId)
+		SELECT u.id, n.id FROM public.notifications n, public.users u
+		WHERE u.id = $1 AND `+unreadCondition+`
+		ON CONFLICT DO NOTHING
+	`, userID)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// ReadNotificationIDs returns the ids of the notifications the user has read
+func ReadNotificationIDs(db *sql.DB, userID string) (map[string]bool, error) {
+	rows, err := db.Query(`SELECT notificationId FROM public.notification_reads WHERE userId = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	read := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		read[id] = true
+	}
+
+	return read, rows.Err()
+}
+
+// UnreadCount counts the notifications the user can see and hasn't read
+func UnreadCount(db *sql.DB, userID string) (int, error) {
+	counts, err := UnreadCounts(db, []string{userID})
+	return counts[userID], err
+}
+
+// UnreadCounts counts the unread notifications of each of the users in one query, users
+// with none are left out
+func UnreadCounts(db *sql.DB, userIDs []string) (map[string]int, error) {
+	counts := make(map[string]int)
+	if len(userIDs) == 0 {
+		return counts, nil
+	}
+
+	rows, err := db.Query(`
+		SELECT u.id, COUNT(*) FROM public.users u, public.notifications n
+		WHERE u.id = ANY($1::uuid[]) AND `+unreadCondition+`
+		GROUP BY u.id
+	`, pq.Array(userIDs))
+	if err != nil {
+		return counts, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id string
+		var count int
+		if err := rows.Scan(&id, &count); err != nil {
+			return counts, err
+		}
+		counts[id] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// GetReadStats works out how many of the users a notification is for have read it
+func GetReadStats(db *sql.DB, notif Notification) (ReadStats, error) {
+	var stats ReadStats
+
+	size, err := CountAudience(db, notif.Targets)
+	if err != nil {
+		return stats, err
+	}
+	stats.Users = size.Users
+
+	err = db.QueryRow(`SELECT COUNT(*) FROM public.notification_reads WHERE notificationId = $1`, notif.ID).Scan(&stats.Read)
+	if err != nil {
+		return stats, err
+	}
+
+	if stats.Users > 0 {
+		stats.Rate = float64(stats.Read) / float64(stats.Users)
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,141 @@
+package database
+
+import (
+	"database/sql"
+	"os"
+	"time"
+)
+
+const defaultAgendaTimezone = "America/New_York"
+
+// Reminder is a push due to a user about an item in their agenda starting soon
+type Reminder struct {
+	UserID   string
+	AgendaID string
+	EventID  string
+	Title    string
+	Location string
+	Date     time.Time
+}
+
+/*
+agendaTimezone is the timezone the agenda times are written in, set with
+AGENDA_TIMEZONE. They are stored without one, as the local time at the
+conference, so they have to be put in it before being compared to now.
+*/
+func agendaTimezone() string {
+	if tz := os.Getenv("AGENDA_TIMEZONE"); tz != "" {
+		return tz
+	}
+
+	return defaultAgendaTimezone
+}
+
+// GetFavorites returns the ids of the general agenda items the user has favorited
+func GetFavorites(db *sql.DB, userID string) ([]string, error) {
+	rows, err := db.Query(`
+		SELECT f.agendaId FROM public.user_favorites f
+		JOIN public.agenda a ON a.id = f.agendaId
+		WHERE f.userId = $1 AND a.deletedAt IS NULL
+		ORDER BY a.date
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make([]string, 0)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// AddFavorite favorites a general agenda item for the user, returning false if there is no such item
+func AddFavorite(db *sql.DB, userID string, agendaID string) (bool, error) {
+	res, err := db.Exec(`
+		INSERT INTO public.user_favorites (userId, agendaId)
+		SELECT $1, id FROM public.agenda WHERE id = $2 AND eventId IS NULL AND deletedAt IS NULL
+		ON CONFLICT DO NOTHING
+	`, userID, agendaID)
+	if err != nil {
+		return false, err
+	}
+
+	if added, _ := res.RowsAffected(); added > 0 {
+		return true, nil
+	}
+
+	// Favoriting twice is fine, it just has to exist
+	var exists bool
+	err = db.QueryRow(`SELECT EXISTS(SELECT 1 FROM public.agenda WHERE id = $1 AND eventId IS NULL AND deletedAt IS NULL)`, agendaID).Scan(&exists)
+	return exists, err
+}
+
+// RemoveFavorite takes an item out of the user's favorites
+func RemoveFavorite(db *sql.DB, userID string, agendaID string) error {
+	_, err := db.Exec(`DELETE FROM public.user_favorites WHERE userId = $1 AND agendaId = $2`, userID, agendaID)
+	return err
+}
+
+/*
+ClaimDueReminders finds the items starting within each user's reminder window,
+from their favorites and the schedules of the events they follow, and records
+them as sent so they are only returned once. Sent reminders are keyed by the
+item's start time, so when an item is moved it comes up again for the new time.
+*/
+func ClaimDueReminders(db *sql.DB) ([]Reminder, error) {
+	rows, err := db.Query(`
+		WITH items AS (
+			SELECT ua.userId, a.id, COALESCE(a.eventId::text, '') AS eventId, a.title, a.location, a.date
+			FROM public.user_agenda ua
+			JOIN public.agenda a ON a.eventId = ua.eventId
+			JOIN public.event e ON e.id = a.eventId
+			WHERE a.published = true AND a.deletedAt IS NULL AND e.deletedAt IS NULL
+			UNION
+			SELECT f.userId, a.id, '', a.title, a.location, a.date
+			FROM public.user_favorites f
+			JOIN public.agenda a ON a.id = f.agendaId
+			WHERE a.published = true AND a.deletedAt IS NULL
+		), due AS (
+			SELECT i.* FROM items i
+			JOIN public.user_preferences p ON p.userId = i.userId
+			WHERE p.remindersEnabled
+				AND (i.date AT TIME ZONE $1) > CURRENT_TIMESTAMP
+				AND (i.date AT TIME ZONE $1) <= CURRENT_TIMESTAMP + p.reminderMinutes * INTERVAL '1 minute'
+		), claimed AS (
+			INSERT INTO public.reminders_sent (userId, agendaId, startsAt)
+			SELECT userId, id, date FROM due
+			ON CONFLICT DO NOTHING
+			RETURNING userId, agendaId, startsAt
+		)
+		SELECT d.userId, d.id, d.eventId, d.title, d.location, d.date
+		FROM due d JOIN claimed c ON c.userId = d.userId AND c.agendaId = d.id AND c.startsAt = d.date
+	`, agendaTimezone())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reminders := make([]Reminder, 0)
+	for rows.Next() {
+		var reminder Reminder
+		if err := rows.Scan(&reminder.UserID, &reminder.AgendaID, &reminder.EventID, &reminder.Title, &reminder.Location, &reminder.Date); err != nil {
+			return reminders, err
+		}
+		reminders = append(reminders, reminder)
+	}
+
+	return reminders, rows.Err()
+}
+
+// PruneReminders forgets the reminders sent before the cutoff
+func PruneReminders(db *sql.DB, cutoff time.Time) error {
+	_, err := db.Exec(`DELETE FROM public.reminders_sent WHERE sentAt < $1`, cutoff)
+	return err
+}
@@ -0,0 +1,43 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+)
+
+var ErrNotRetractable = errors.New("notification has not been sent or is already retracted")
+
+/*
+RetractNotification pulls back a notification that has gone out. It is
+unpublished so it drops out of everyone's feed and anything of it still in the
+push queue is cancelled. The app is told to delete its copy with a silent push,
+see notifications.SendRetraction.
+*/
+func RetractNotification(db *sql.DB, id string) (Notification, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return Notification{}, err
+	}
+	defer tx.Rollback()
+
+	notif, err := scanNotification(tx.QueryRow(`
+		UPDATE public.notifications SET published = false, status = '`+StatusRetracted+`', retractedAt = CURRENT_TIMESTAMP
+		WHERE id = $1 AND published = true AND retractedAt IS NULL AND deletedAt IS NULL
+		RETURNING `+notificationColumns, id))
+	if err == sql.ErrNoRows {
+		return notif, ErrNotRetractable
+	}
+	if err != nil {
+		return notif, err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE public.push_queue SET status = 'failed', lastError = 'retracted'
+		WHERE notificationId = $1 AND status = 'queued'
+	`, id)
+	if err != nil {
+		return notif, err
+	}
+
+	return notif, tx.Commit()
+}
@@ -0,0 +1,123 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+/*
+Agenda items and notifications can be given a publishAt time instead of being
+published straight away. The publish scheduler claims anything that is due with
+a single UPDATE ... RETURNING, so even with several backends running only one of
+them gets each item and a notification is only ever sent once.
+*/
+
+// ScheduledItem is an agenda item or notification waiting to be published
+type ScheduledItem struct {
+	Type      string    `json:"type"` // "agenda" or "notification"
+	ID        string    `json:"id"`
+	Title     string    `json:"title"`
+	PublishAt time.Time `json:"publishAt"`
+}
+
+var ErrNotScheduled = errors.New("item is not scheduled")
+
+// TimePtr turns a nullable time column into an optional time
+func TimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+// ClaimDueNotifications publishes every approved scheduled notification whose time has
+// come and returns them. Each notification is only ever returned to one caller.
+func ClaimDueNotifications(db *sql.DB) ([]Notification, error) {
+	rows, err := db.Query(`
+		UPDATE public.notifications SET published = true, publishAt = NULL, status = 'sent'
+		WHERE publishAt <= CURRENT_TIMESTAMP AND published = false AND status = 'approved' AND deletedAt IS NULL
+		RETURNING ` + notificationColumns)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanNotifications(rows)
+}
+
+// ClaimDueAgenda publishes every scheduled agenda item whose time has come and returns them
+func ClaimDueAgenda(db *sql.DB) ([]Agenda, error) {
+	rows, err := db.Query(`
+		UPDATE public.agenda SET published = true, publishAt = NULL
+		WHERE publishAt <= CURRENT_TIMESTAMP AND published = false AND deletedAt IS NULL
+		RETURNING id, title, description, date, endtime, location, published, icon, eventId, createdAt
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	agendas := make([]Agenda, 0)
+	for rows.Next() {
+		var item Agenda
+		var eventID sql.NullString
+		err := rows.Scan(&item.ID, &item.Title, &item.Description, &item.Date, &item.EndTime, &item.Location, &item.Published, &item.Icon, &eventID, &item.CreatedAt)
+		if err != nil {
+			return agendas, err
+		}
+		item.EventId = eventID.String
+		agendas = append(agendas, item)
+	}
+
+	return agendas, rows.Err()
+}
+
+// ListScheduled returns everything waiting to be published, soonest first
+func ListScheduled(db *sql.DB) ([]ScheduledItem, error) {
+	rows, err := db.Query(`
+		SELECT 'agenda', id, title, publishAt FROM public.agenda
+		WHERE publishAt IS NOT NULL AND published = false AND deletedAt IS NULL
+		UNION ALL
+		SELECT 'notification', id, title, publishAt FROM public.notifications
+		WHERE publishAt IS NOT NULL AND published = false AND deletedAt IS NULL
+		ORDER BY 4
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]ScheduledItem, 0)
+	for rows.Next() {
+		var item ScheduledItem
+		if err := rows.Scan(&item.Type, &item.ID, &item.Title, &item.PublishAt); err != nil {
+			return items, err
+		}
+		items = append(items, item)
+	}
+
+	return items, rows.Err()
+}
+
+// CancelScheduled clears the publish time of a scheduled item, leaving it unpublished
+func CancelScheduled(db *sql.DB, itemType string, id string) error {
+	var query string
+	switch itemType {
+	case "agenda":
+		query = `UPDATE public.agenda SET publishAt = NULL WHERE id = $1 AND publishAt IS NOT NULL AND published = false AND deletedAt IS NULL`
+	case "notification":
+		query = `UPDATE public.notifications SET publishAt = NULL, status = 'draft' WHERE id = $1 AND publishAt IS NOT NULL AND published = false AND deletedAt IS NULL`
+	default:
+		return ErrNotScheduled
+	}
+
+	res, err := db.Exec(query, id)
+	if err != nil {
+		return err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return ErrNotScheduled
+	}
+
+	return nil
+}
@@ -203,4 +203,492 @@ CREATE TABLE IF NOT EXISTS public.devices (
 CREATE TABLE IF NOT EXISTS public.finalists (
     userid UUID REFERENCES public.users(id),
     eventid UUID REFERENCES public.event(id)
-);
\ No newline at end of file
+);
+
+/*
+    Indexes backing the paginated admin list endpoints. Every sortable
+    and filterable column gets one so paging stays an index scan.
+ */
+CREATE INDEX IF NOT EXISTS users_fullname_idx ON public.users (fullName, id);
+CREATE INDEX IF NOT EXISTS users_shortname_idx ON public.users (shortName, id);
+CREATE INDEX IF NOT EXISTS users_schoolid_idx ON public.users (schoolId);
+CREATE INDEX IF NOT EXISTS school_schoolname_idx ON public.school (schoolName, id);
+CREATE INDEX IF NOT EXISTS event_name_idx ON public.event (name, id);
+CREATE INDEX IF NOT EXISTS event_starttime_idx ON public.event ("startTime", id);
+
+/*
+    Fuzzy search uses trigram matching from pg_trgm. These GIN indexes
+    back both the <% (word similarity) operator and ILIKE.
+ */
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+CREATE INDEX IF NOT EXISTS users_fullname_trgm_idx ON public.users USING gin (fullName gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS users_shortname_trgm_idx ON public.users USING gin (shortName gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS school_schoolname_trgm_idx ON public.school USING gin (schoolName gin_trgm_ops);
+CREATE INDEX IF NOT EXISTS event_name_trgm_idx ON public.event USING gin (name gin_trgm_ops);
+
+/*
+    This table is the append-only audit log of every admin mutation.
+
+    id: A unique, increasing identifier for the entry.
+    actorKeyId: The api key that made the change.
+    actor: The admin that owns the key, or the key's purpose if it isn't an admin's.
+    action: What was done, e.g. create, update, delete.
+    entityType: The kind of thing that was changed, e.g. agenda, event, notification.
+    entityId: The unique identifier of the thing that was changed.
+    before: The JSON of the entity before the change, null when it was created.
+    after: The JSON of the entity after the change, null when it was deleted.
+    ip: The ip address the request came from.
+    createdAt: The date and time the change was made.
+ */
+CREATE TABLE IF NOT EXISTS public.audit_log (
+    id          BIGSERIAL PRIMARY KEY,
+    actorKeyId  UUID,
+    actor       TEXT NOT NULL,
+    action      TEXT NOT NULL,
+    entityType  TEXT NOT NULL,
+    entityId    TEXT,
+    before      JSONB,
+    after       JSONB,
+    ip          TEXT,
+    createdAt   TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_createdat_idx ON public.audit_log (createdAt, id);
+CREATE INDEX IF NOT EXISTS audit_log_entity_idx ON public.audit_log (entityType, entityId);
+
+-- Nothing is allowed to change or remove audit entries
+CREATE OR REPLACE FUNCTION public.audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE OR REPLACE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE ON public.audit_log
+    FOR EACH ROW EXECUTE FUNCTION public.audit_log_append_only();
+
+/*
+    Agenda items, events and notifications are soft deleted. A non null
+    deletedAt means the row is in the trash, it is purged for good once
+    it has been there longer than the retention window.
+ */
+ALTER TABLE public.agenda ADD COLUMN IF NOT EXISTS deletedAt TIMESTAMP;
+ALTER TABLE public.event ADD COLUMN IF NOT EXISTS deletedAt TIMESTAMP;
+ALTER TABLE public.notifications ADD COLUMN IF NOT EXISTS deletedAt TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS agenda_deletedat_idx ON public.agenda (deletedAt) WHERE deletedAt IS NOT NULL;
+CREATE INDEX IF NOT EXISTS event_deletedat_idx ON public.event (deletedAt) WHERE deletedAt IS NOT NULL;
+CREATE INDEX IF NOT EXISTS notifications_deletedat_idx ON public.notifications (deletedAt) WHERE deletedAt IS NOT NULL;
+
+/*
+    Agenda items and notifications can be scheduled to be published
+    later. publishAt is cleared once the item has been published.
+ */
+ALTER TABLE public.agenda ADD COLUMN IF NOT EXISTS publishAt TIMESTAMP;
+ALTER TABLE public.notifications ADD COLUMN IF NOT EXISTS publishAt TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS agenda_publishat_idx ON public.agenda (publishAt) WHERE publishAt IS NOT NULL;
+CREATE INDEX IF NOT EXISTS notifications_publishat_idx ON public.notifications (publishAt) WHERE publishAt IS NOT NULL;
+
+/*
+    This table contains the background jobs. Recurring jobs have a
+    schedule, one-shot jobs don't and have their runAt cleared once run.
+
+    name: A unique name for the job.
+    handler: The name of the registered handler that does the work.
+    schedule: A cron expression or "@every <duration>", null for one-shot jobs.
+    runAt: When the job is next due, null if it isn't.
+    payload: JSON handed to the handler.
+    enabled: Disabled jobs are never run.
+    lastRunAt: When the job was last started.
+    createdAt: The date and time the job was created.
+ */
+CREATE TABLE IF NOT EXISTS public.jobs (
+    name        TEXT PRIMARY KEY,
+    handler     TEXT NOT NULL,
+    schedule    TEXT,
+    runAt       TIMESTAMP,
+    payload     JSONB,
+    enabled     BOOLEAN NOT NULL DEFAULT TRUE,
+    lastRunAt   TIMESTAMP,
+    createdAt   TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS jobs_runat_idx ON public.jobs (runAt) WHERE runAt IS NOT NULL;
+
+/*
+    This table contains the history of job runs.
+
+    id: A unique identifier for the run.
+    jobName: The job that was run.
+    instance: The backend replica that ran it.
+    status: running, succeeded or failed.
+    error: The error the job failed with.
+    startedAt: When the run started.
+    finishedAt: When the run finished.
+ */
+CREATE TABLE IF NOT EXISTS public.job_runs (
+    id          BIGSERIAL PRIMARY KEY,
+    jobName     TEXT NOT NULL REFERENCES public.jobs(name) ON DELETE CASCADE,
+    instance    TEXT NOT NULL,
+    status      TEXT NOT NULL,
+    error       TEXT,
+    startedAt   TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    finishedAt  TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS job_runs_jobname_idx ON public.job_runs (jobName, startedAt DESC);
+
+/*
+    Notifications go through an approval workflow before being sent:
+    draft -> pending -> approved/sent, or rejected. Notifications that
+    reach the whole conference or a large audience need a second admin
+    to approve them.
+
+    status: draft, pending, approved, rejected or sent.
+    submittedByKeyId: The api key that created or last edited the notification, it can't approve it.
+    createdBy: The name of the admin that created the notification.
+ */
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = 'public' AND table_name = 'notifications' AND column_name = 'status'
+    ) THEN
+        ALTER TABLE public.notifications ADD COLUMN status TEXT NOT NULL DEFAULT 'draft';
+
+        -- Only when the column is first added, notifications from before the workflow
+        -- existed have already gone out or were already scheduled
+        UPDATE public.notifications SET status = 'sent' WHERE published = true;
+        UPDATE public.notifications SET status = 'approved' WHERE status = 'draft' AND publishAt IS NOT NULL;
+    END IF;
+END $$;
+ALTER TABLE public.notifications ADD COLUMN IF NOT EXISTS submittedByKeyId UUID;
+ALTER TABLE public.notifications ADD COLUMN IF NOT EXISTS createdBy TEXT;
+
+CREATE INDEX IF NOT EXISTS notifications_status_idx ON public.notifications (status) WHERE status = 'pending';
+
+/*
+    This table is the approval history of the notifications.
+
+    id: A unique identifier for the review step.
+    notificationId: The notification that was reviewed.
+    actorKeyId: The api key of the admin that took the step.
+    actor: The name of the admin that took the step.
+    action: submit, approve, reject or comment.
+    comment: An optional comment left with the step.
+    createdAt: The date and time of the step.
+ */
+CREATE TABLE IF NOT EXISTS public.notification_reviews (
+    id              BIGSERIAL PRIMARY KEY,
+    notificationId  UUID NOT NULL REFERENCES public.notifications(id) ON DELETE CASCADE,
+    actorKeyId      UUID,
+    actor           TEXT NOT NULL,
+    action          TEXT NOT NULL,
+    comment         TEXT,
+    createdAt       TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS notification_reviews_notificationid_idx ON public.notification_reviews (notificationId, createdAt);
+
+/*
+    This table contains reusable notifications. Their title and description can
+    contain placeholders like {{event.name}} or {{user.shortName}} that are filled
+    in for each recipient.
+
+    id: A unique identifier for the template.
+    name: The name the template is picked by.
+    title: The title of the notification.
+    description: The body of the notification.
+    type: The type of notification it creates.
+    createdAt: The date and time the template was created.
+    updatedAt: The date and time the template was last changed.
+ */
+CREATE TABLE IF NOT EXISTS public.notification_templates (
+    id          UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    name        TEXT NOT NULL UNIQUE,
+    title       TEXT NOT NULL,
+    description TEXT NOT NULL,
+    type        TEXT NOT NULL DEFAULT 'general',
+    createdAt   TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updatedAt   TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+/*
+    eventId: The event used to fill in the {{event.*}} placeholders of a notification.
+ */
+ALTER TABLE public.notifications ADD COLUMN IF NOT EXISTS eventId UUID REFERENCES public.event(id) ON DELETE SET NULL;
+
+/*
+    role: What the user is at the conference, like student or advisor. Notifications can target a role,
+    and advisors of a school.
+ */
+ALTER TABLE public.users ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'student';
+
+CREATE INDEX IF NOT EXISTS users_role_idx ON public.users (role);
+
+/*
+    targets: Who the notification is for, a jsonb list of {"type", "id"} where type is
+    all, user, school, event, role or advisors (of a school). Replaces userids, which mixed
+    user, school and event ids together.
+ */
+ALTER TABLE public.notifications ADD COLUMN IF NOT EXISTS targets JSONB;
+
+-- Work out what every id in the old userids was
+UPDATE public.notifications n SET targets = CASE
+    WHEN NOT n.private THEN '[{"type": "all"}]'::jsonb
+    ELSE (
+        SELECT COALESCE(jsonb_agg(jsonb_build_object('type', CASE
+            WHEN EXISTS (SELECT 1 FROM public.users WHERE id = x) THEN 'user'
+            WHEN EXISTS (SELECT 1 FROM public.school WHERE id = x) THEN 'school'
+            ELSE 'event' END, 'id', x::text)), '[]'::jsonb)
+        FROM unnest(n.userids) AS x
+    ) END
+WHERE n.targets IS NULL;
+
+/*
+    clearedAt: When an emergency notification was declared over. Until then it is
+    pinned at the top of the app and shown on the status endpoint.
+ */
+ALTER TABLE public.notifications ADD COLUMN IF NOT EXISTS clearedAt TIMESTAMP;
+
+/*
+    This table is the queue of pushes waiting to be sent, one row per device.
+    Workers on every replica claim rows with FOR UPDATE SKIP LOCKED.
+
+    id: A unique identifier for the push.
+    notificationId: The notification the push is for, if any.
+    userId: The user the device belongs to, if any.
+    token: The device token to send to.
+    deviceType: The platform of the device.
+    priority: Higher priorities are sent first, emergencies are 10.
+    message: The rendered title, body and data of the push.
+    status: queued, sending, sent or failed.
+    attempts: How many times sending has been tried.
+    nextAttemptAt: When the push can next be tried, used for backoff.
+    lockedAt: When a worker claimed the push.
+    lastError: Why the last attempt failed.
+    createdAt: When the push was queued.
+    sentAt: When the push was accepted.
+ */
+CREATE TABLE IF NOT EXISTS public.push_queue (
+    id              BIGSERIAL PRIMARY KEY,
+    notificationId  UUID REFERENCES public.notifications(id) ON DELETE CASCADE,
+    userId          UUID,
+    token           TEXT NOT NULL,
+    deviceType      TEXT NOT NULL,
+    priority        INTEGER NOT NULL DEFAULT 0,
+    message         JSONB NOT NULL,
+    status          TEXT NOT NULL DEFAULT 'queued',
+    attempts        INTEGER NOT NULL DEFAULT 0,
+    nextAttemptAt   TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    lockedAt        TIMESTAMP,
+    lastError       TEXT,
+    createdAt       TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    sentAt          TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS push_queue_due_idx ON public.push_queue (priority DESC, id) WHERE status IN ('queued', 'sending');
+CREATE INDEX IF NOT EXISTS push_queue_notificationid_idx ON public.push_queue (notificationId);
+
+/*
+    This table records how pushing each notification to each device went.
+
+    id: A unique identifier for the delivery.
+    notificationId: The notification that was pushed.
+    pushId: The push in the queue, there is one delivery per push.
+    deviceId: The device it went to, cleared if the device is removed.
+    userId: The user the device belongs to, if any.
+    token: The end of the device token, the full token isn't kept.
+    status: sent, retrying, failed or invalid (the token was dead and the device removed).
+    apnsId: The id APNs gave the push, or the FCM message id for android.
+    reason: Why the push failed, as given by the push service.
+    attempts: How many times the push was tried.
+    createdAt: When the push was first tried.
+    updatedAt: When the status last changed.
+ */
+CREATE TABLE IF NOT EXISTS public.deliveries (
+    id              BIGSERIAL PRIMARY KEY,
+    notificationId  UUID NOT NULL REFERENCES public.notifications(id) ON DELETE CASCADE,
+    pushId          BIGINT NOT NULL UNIQUE,
+    deviceId        UUID REFERENCES public.devices(id) ON DELETE SET NULL,
+    userId          UUID,
+    token           TEXT NOT NULL,
+    status          TEXT NOT NULL,
+    apnsId          TEXT,
+    reason          TEXT,
+    attempts        INTEGER NOT NULL DEFAULT 1,
+    createdAt       TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updatedAt       TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS deliveries_notificationid_idx ON public.deliveries (notificationId, status);
+
+/*
+    environment: Which APNs environment an ios device's token is from, production
+    for App Store and TestFlight builds or sandbox for development builds.
+ */
+ALTER TABLE public.devices ADD COLUMN IF NOT EXISTS environment TEXT NOT NULL DEFAULT 'production';
+ALTER TABLE public.push_queue ADD COLUMN IF NOT EXISTS environment TEXT NOT NULL DEFAULT 'production';
+
+/*
+    link: What the notification opens when tapped, jsonb {"type", "id", "url"} where
+    type is event, agenda, resource or url.
+    imageUrl: An image attached to the push.
+    category: The action buttons shown with the push, like ADD_TO_AGENDA.
+ */
+ALTER TABLE public.notifications ADD COLUMN IF NOT EXISTS link JSONB;
+ALTER TABLE public.notifications ADD COLUMN IF NOT EXISTS imageUrl TEXT;
+ALTER TABLE public.notifications ADD COLUMN IF NOT EXISTS category TEXT;
+
+/*
+    This table holds each user's settings, a user without a row has the defaults.
+
+    userId: The user the settings belong to.
+    remindersEnabled: Whether the user gets a push before the items in their agenda start.
+    reminderMinutes: How many minutes before an item starts the reminder is sent.
+    updatedAt: When the settings were last changed.
+ */
+CREATE TABLE IF NOT EXISTS public.user_preferences (
+    userId              UUID PRIMARY KEY REFERENCES public.users(id) ON DELETE CASCADE,
+    remindersEnabled    BOOLEAN NOT NULL DEFAULT FALSE,
+    reminderMinutes     INTEGER NOT NULL DEFAULT 15,
+    updatedAt           TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+/*
+    This table links users to the general agenda items they have favorited, which they
+    get reminders for along with the schedules of the events they follow.
+
+    userId: The unique identifier of the user.
+    agendaId: The unique identifier of the agenda item.
+ */
+CREATE TABLE IF NOT EXISTS public.user_favorites (
+    userId      UUID REFERENCES public.users(id) ON DELETE CASCADE,
+    agendaId    UUID REFERENCES public.agenda(id) ON DELETE CASCADE,
+    createdAt   TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (userId, agendaId)
+);
+
+/*
+    This table records the reminders that have been sent so each goes out once.
+
+    userId: The user that was reminded.
+    agendaId: The agenda item they were reminded about.
+    startsAt: When the item started at the time of the reminder. It is part of the key
+    so an item that is moved gets a new reminder for its new time.
+    sentAt: When the reminder was sent.
+ */
+CREATE TABLE IF NOT EXISTS public.reminders_sent (
+    userId      UUID REFERENCES public.users(id) ON DELETE CASCADE,
+    agendaId    UUID REFERENCES public.agenda(id) ON DELETE CASCADE,
+    startsAt    TIMESTAMP NOT NULL,
+    sentAt      TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (userId, agendaId, startsAt)
+);
+
+/*
+    mutedTypes: The notification types the user doesn't want pushes for, out of general,
+    event and chapter. They still see them in the app. Emergencies can't be muted.
+    quietHoursStart, quietHoursEnd: A time of day in the conference's timezone when the
+    user doesn't get pushes, except emergencies. It wraps past midnight when the start
+    is after the end. Both are null when the user has no quiet hours.
+ */
+ALTER TABLE public.user_preferences ADD COLUMN IF NOT EXISTS mutedTypes TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE public.user_preferences ADD COLUMN IF NOT EXISTS quietHoursStart TIME;
+ALTER TABLE public.user_preferences ADD COLUMN IF NOT EXISTS quietHoursEnd TIME;
+
+/*
+    This table records which notifications each user has read, so the unread count
+    and the "new" markers are the same on all of their devices.
+
+    userId: The user that read the notification.
+    notificationId: The notification they read.
+    readAt: When they read it.
+ */
+CREATE TABLE IF NOT EXISTS public.notification_reads (
+    userId          UUID REFERENCES public.users(id) ON DELETE CASCADE,
+    notificationId  UUID REFERENCES public.notifications(id) ON DELETE CASCADE,
+    readAt          TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+
+    PRIMARY KEY (userId, notificationId)
+);
+
+CREATE INDEX IF NOT EXISTS notification_reads_notificationid_idx ON public.notification_reads (notificationId);
+
+/*
+    retractedAt: When the notification was pulled back after going out. It is unpublished
+    and the apps are told to delete it.
+    correctsId: The notification this one corrects. The original is retracted when the
+    correction goes out.
+ */
+ALTER TABLE public.notifications ADD COLUMN IF NOT EXISTS retractedAt TIMESTAMP;
+ALTER TABLE public.notifications ADD COLUMN IF NOT EXISTS correctsId UUID REFERENCES public.notifications(id) ON DELETE SET NULL;
+
+/*
+    channels: How the notification is sent, push and/or email. Emails go to the users.email
+    of everyone it targets.
+ */
+ALTER TABLE public.notifications ADD COLUMN IF NOT EXISTS channels TEXT[] NOT NULL DEFAULT '{push}';
+
+/*
+    channel: Whether the delivery was a push or an email. For emails token is the end of the
+    address and apnsId the Message-ID.
+ */
+ALTER TABLE public.deliveries ADD COLUMN IF NOT EXISTS channel TEXT NOT NULL DEFAULT 'push';
+
+/*
+    webP256dh, webAuth: The encryption keys of a web push subscription, only set for web
+    devices. For those the token is the subscription's endpoint.
+ */
+ALTER TABLE public.devices ADD COLUMN IF NOT EXISTS webP256dh TEXT;
+ALTER TABLE public.devices ADD COLUMN IF NOT EXISTS webAuth TEXT;
+
+/*
+    This table holds the VAPID key pair web pushes are signed with. There is only ever one
+    row, made the first time a web push is sent or a browser asks for the public key, so
+    every replica uses the same keys. Browsers subscribed with the public key, so changing
+    it means they have to subscribe again.
+
+    publicKey, privateKey: The keys, base64url encoded.
+    createdAt: When the keys were made.
+ */
+CREATE TABLE IF NOT EXISTS public.vapid_keys (
+    id          INTEGER PRIMARY KEY DEFAULT 1 CHECK (id = 1),
+    publicKey   TEXT NOT NULL,
+    privateKey  TEXT NOT NULL,
+    createdAt   TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+/*
+    lastSeenAt: When the app last registered the device, it does so every launch.
+    appVersion: The version of the app on the device.
+    osVersion: The version of iOS, Android or the browser the device is on.
+ */
+ALTER TABLE public.devices ADD COLUMN IF NOT EXISTS lastSeenAt TIMESTAMP DEFAULT CURRENT_TIMESTAMP;
+ALTER TABLE public.devices ADD COLUMN IF NOT EXISTS appVersion TEXT;
+ALTER TABLE public.devices ADD COLUMN IF NOT EXISTS osVersion TEXT;
+
+CREATE INDEX IF NOT EXISTS devices_userid_idx ON public.devices (userId);
+
+/*
+    This table holds the api keys that can send emergency notifications. Emergencies skip
+    approval and everyone's mutes, so only the keys listed here can publish one. Rows are
+    added by hand like api keys are.
+
+    apiKeyId: The api key that can send emergencies.
+    grantedAt: When it was given the permission.
+ */
+CREATE TABLE IF NOT EXISTS public.emergency_senders (
+    apiKeyId    UUID PRIMARY KEY REFERENCES public.api_keys(id) ON DELETE CASCADE,
+    grantedAt   TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+/*
+    attempts: How many times a one-shot job has been tried since it was enqueued, failed
+    ones are tried again with backoff.
+ */
+ALTER TABLE public.jobs ADD COLUMN IF NOT EXISTS attempts INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,134 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+/*
+Searching is done with the pg_trgm extension so that it tolerates typos
+("Webmastr", "Panter Creek"). Every searchable column has a trigram GIN
+index (see schema.sql) which both the <% operator and ILIKE can use.
+
+All the helpers here expect the search term to be bound to $1.
+*/
+
+// SearchResult is a single ranked hit from the unified search
+type SearchResult struct {
+	Type     string  `json:"type"` // "user", "school" or "event"
+	ID       string  `json:"id"`
+	Title    string  `json:"title"`
+	Subtitle string  `json:"subtitle,omitempty"`
+	Score    float64 `json:"score"`
+}
+
+var SearchTypes = []string{"user", "school", "event"}
+
+// trigramMatch is the condition matching the search term against any of the columns.
+// A plain substring match is kept so short terms that don't make a full trigram still hit.
+func trigramMatch(columns ...string) string {
+	conditions := make([]string, 0, len(columns)*2)
+	for _, column := range columns {
+		conditions = append(conditions,
+			fmt.Sprintf("$1::text <%% %s", column),
+			fmt.Sprintf("%s ILIKE '%%' || $1::text || '%%'", column))
+	}
+	return "(" + strings.Join(conditions, " OR ") + ")"
+}
+
+// trigramRank is the relevance of a row to the search term, between 0 and 1
+func trigramRank(columns ...string) string {
+	ranks := make([]string, 0, len(columns))
+	for _, column := range columns {
+		ranks = append(ranks, fmt.Sprintf("word_similarity($1::text, %s)", column))
+	}
+	if len(ranks) == 1 {
+		return ranks[0]
+	}
+	return "GREATEST(" + strings.Join(ranks, ", ") + ")"
+}
+
+// withSearch adds the trigram search on the columns to a list query and sorts by
+// relevance unless the caller asked for another order
+func withSearch(q listQuery, opts ListOptions, columns ...string) (listQuery, ListOptions, []string, []any) {
+	if opts.Search == "" {
+		return q, opts, nil, nil
+	}
+
+	sortable := make(map[string]string, len(q.sortable)+1)
+	for key, column := range q.sortable {
+		sortable[key] = column
+	}
+	sortable["relevance"] = trigramRank(columns...)
+	q.sortable = sortable
+
+	if opts.Sort == "" {
+		opts.Sort = "relevance"
+		opts.Desc = true
+	}
+
+	return q, opts, []string{trigramMatch(columns...)}, []any{opts.Search}
+}
+
+// Search runs a ranked fuzzy search across users, schools and events
+func Search(db *sql.DB, term string, types []string, limit int) ([]SearchResult, error) {
+	limit = normalizeLimit(limit)
+
+	queries := map[string]string{
+		"user": fmt.Sprintf(`
+			SELECT 'user', u.id::text, u.fullName, COALESCE(s.schoolName, ''), %s
+			FROM users u LEFT JOIN school s ON s.id = u.schoolId
+			WHERE %s`,
+			trigramRank("u.fullName", "u.shortName"), trigramMatch("u.fullName", "u.shortName")),
+		"school": fmt.Sprintf(`
+			SELECT 'school', id::text, schoolName, '', %s
+			FROM school
+			WHERE %s`,
+			trigramRank("schoolName"), trigramMatch("schoolName")),
+		"event": fmt.Sprintf(`
+			SELECT 'event', id::text, name, location, %s
+			FROM event
+			WHERE deletedAt IS NULL AND %s`,
+			trigramRank("name"), trigramMatch("name")),
+	}
+
+	parts := make([]string, 0, len(types))
+	for _, t := range types {
+		query, ok := queries[t]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown search type %q", ErrInvalidListOptions, t)
+		}
+		parts = append(parts, query)
+	}
+	if len(parts) == 0 {
+		return []SearchResult{}, nil
+	}
+
+	rows, err := db.Query(strings.Join(parts, " UNION ALL ")+" ORDER BY 5 DESC, 3 LIMIT $2", term, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := make([]SearchResult, 0)
+	for rows.Next() {
+		var result SearchResult
+		if err := rows.Scan(&result.Type, &result.ID, &result.Title, &result.Subtitle, &result.Score); err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	return results, rows.Err()
+}
+
+// SearchEvents returns the events best matching the search term, used by the app's event search
+func SearchEvents(db *sql.DB, term string, limit int) ([]Event, error) {
+	page, err := ListEvents(db, ListOptions{Search: term, Limit: limit})
+	if err != nil {
+		return nil, err
+	}
+
+	return page.Items, nil
+}
@@ -0,0 +1,103 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// NotificationTemplate is a stored notification that can be reused, its title and
+// description can contain placeholders like {{event.name}} or {{user.shortName}}
+type NotificationTemplate struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name" binding:"required"`
+	Title       string    `json:"title" binding:"required"`
+	Description string    `json:"description" binding:"required"`
+	Type        string    `json:"type,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// TemplateUser is what a template can say about the user it is sent to
+type TemplateUser struct {
+	ID         string
+	ShortName  string
+	FullName   string
+	SchoolName string
+}
+
+func GetTemplates(db *sql.DB) ([]NotificationTemplate, error) {
+	rows, err := db.Query(`SELECT id, name, title, description, type, createdAt, updatedAt FROM public.notification_templates ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	templates := make([]NotificationTemplate, 0)
+	for rows.Next() {
+		var t NotificationTemplate
+		if err := rows.Scan(&t.ID, &t.Name, &t.Title, &t.Description, &t.Type, &t.CreatedAt, &t.UpdatedAt); err != nil {
+			return templates, err
+		}
+		templates = append(templates, t)
+	}
+
+	return templates, rows.Err()
+}
+
+func GetTemplate(db *sql.DB, id string) (NotificationTemplate, error) {
+	var t NotificationTemplate
+	err := db.QueryRow(`SELECT id, name, title, description, type, createdAt, updatedAt FROM public.notification_templates WHERE id = $1`, id).
+		Scan(&t.ID, &t.Name, &t.Title, &t.Description, &t.Type, &t.CreatedAt, &t.UpdatedAt)
+	return t, err
+}
+
+func CreateTemplate(db *sql.DB, t NotificationTemplate) (NotificationTemplate, error) {
+	if t.Type == "" {
+		t.Type = "general"
+	}
+
+	err := db.QueryRow(`
+		INSERT INTO public.notification_templates (name, title, description, type)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, createdAt, updatedAt
+	`, t.Name, t.Title, t.Description, t.Type).Scan(&t.ID, &t.CreatedAt, &t.UpdatedAt)
+
+	return t, err
+}
+
+// UpdateTemplate saves the template, returns sql.ErrNoRows if it doesn't exist
+func UpdateTemplate(db *sql.DB, t NotificationTemplate) (NotificationTemplate, error) {
+	if t.Type == "" {
+		t.Type = "general"
+	}
+
+	err := db.QueryRow(`
+		UPDATE public.notification_templates SET name = $2, title = $3, description = $4, type = $5, updatedAt = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING createdAt, updatedAt
+	`, t.ID, t.Name, t.Title, t.Description, t.Type).Scan(&t.CreatedAt, &t.UpdatedAt)
+
+	return t, err
+}
+
+func DeleteTemplate(db *sql.DB, id string) (bool, error) {
+	res, err := db.Exec(`DELETE FROM public.notification_templates WHERE id = $1`, id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+// GetTemplateUser loads the details of a user that templates can use
+func GetTemplateUser(db *sql.DB, userID string) (TemplateUser, error) {
+	var user TemplateUser
+	err := db.QueryRow(`
+		SELECT u.id, u.shortName, u.fullName, COALESCE(s.schoolName, '')
+		FROM public.users u LEFT JOIN public.school s ON s.id = u.schoolId
+		WHERE u.id = $1
+	`, userID).Scan(&user.ID, &user.ShortName, &user.FullName, &user.SchoolName)
+
+	return user, err
+}
@@ -0,0 +1,246 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"os"
+	"strconv"
+	"time"
+)
+
+/*
+Agenda items, events and notifications are soft deleted by setting their
+deletedAt column. They stay in the trash, hidden from everything else, until
+they are restored or purged once the retention window has passed.
+
+Deleting an event takes its schedule (agenda rows linked by eventId) into the
+trash with it, stamped with the same deletedAt so a restore brings back exactly
+what went out together. Follows (user_agenda) and finalists are left alone
+until the event is purged.
+*/
+
+// TrashItem is a soft deleted agenda item, event or notification
+type TrashItem struct {
+	Type      string    `json:"type"` // "agenda", "event" or "notification"
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	DeletedAt time.Time `json:"deletedAt"`
+	PurgeAt   time.Time `json:"purgeAt"`
+}
+
+// EventCascade is everything that goes along with an event when it is deleted
+type EventCascade struct {
+	AgendaItems int `json:"agendaItems"` // moved to the trash with the event
+	Followers   int `json:"followers"`   // removed when the event is purged
+	Finalists   int `json:"finalists"`   // removed when the event is purged
+}
+
+var (
+	ErrNotInTrash    = errors.New("item is not in the trash")
+	ErrParentInTrash = errors.New("the event this belongs to is in the trash")
+)
+
+const defaultTrashRetention = 30 * 24 * time.Hour
+
+// TrashRetention is how long things stay in the trash before being purged,
+// set with TRASH_RETENTION_DAYS
+func TrashRetention() time.Duration {
+	if days, err := strconv.Atoi(os.Getenv("TRASH_RETENTION_DAYS")); err == nil && days > 0 {
+		return time.Duration(days) * 24 * time.Hour
+	}
+
+	return defaultTrashRetention
+}
+
+// Empty reports whether deleting the event would affect anything else
+func (c EventCascade) Empty() bool {
+	return c.AgendaItems == 0 && c.Followers == 0 && c.Finalists == 0
+}
+
+// PreviewEventDelete counts what deleting the event would take with it
+func PreviewEventDelete(db *sql.DB, eventID string) (EventCascade, error) {
+	var cascade EventCascade
+	err := db.QueryRow(`
+		SELECT
+			(SELECT COUNT(*) FROM public.agenda WHERE eventId = $1 AND deletedAt IS NULL),
+			(SELECT COUNT(*) FROM public.user_agenda WHERE eventId = $1),
+			(SELECT COUNT(*) FROM public.finalists WHERE eventid = $1)
+	`, eventID).Scan(&cascade.AgendaItems, &cascade.Followers, &cascade.Finalists)
+
+	return cascade, err
+}
+
+// SoftDeleteAgendaItem moves an agenda item to the trash, returns false if there was nothing to delete
+func SoftDeleteAgendaItem(db *sql.DB, id string) (bool, error) {
+	return softDelete(db, `UPDATE public.agenda SET deletedAt = CURRENT_TIMESTAMP WHERE id = $1 AND deletedAt IS NULL`, id)
+}
+
+// SoftDeleteNotification moves a notification to the trash, returns false if there was nothing to delete
+func SoftDeleteNotification(db *sql.DB, id string) (bool, error) {
+	return softDelete(db, `UPDATE public.notifications SET deletedAt = CURRENT_TIMESTAMP WHERE id = $1 AND deletedAt IS NULL`, id)
+}
+
+func softDelete(db *sql.DB, query string, id string) (bool, error) {
+	res, err := db.Exec(query, id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+// SoftDeleteEvent moves an event and its schedule to the trash
+func SoftDeleteEvent(db *sql.DB, id string) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// CURRENT_TIMESTAMP is the start of the transaction so both get the same deletedAt
+	res, err := tx.Exec(`UPDATE public.event SET deletedAt = CURRENT_TIMESTAMP WHERE id = $1 AND deletedAt IS NULL`, id)
+	if err != nil {
+		return false, err
+	}
+	if affected, err := res.RowsAffected(); err != nil || affected == 0 {
+		return false, err
+	}
+
+	_, err = tx.Exec(`UPDATE public.agenda SET deletedAt = CURRENT_TIMESTAMP WHERE eventId = $1 AND deletedAt IS NULL`, id)
+	if err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit()
+}
+
+// RestoreFromTrash takes an item out of the trash. Restoring an event brings back
+// the schedule that was deleted along with it.
+func RestoreFromTrash(db *sql.DB, itemType string, id string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	switch itemType {
+	case "agenda":
+		var parentDeleted bool
+		err = tx.QueryRow(`
+			SELECT COALESCE(e.deletedAt IS NOT NULL, false)
+			FROM public.agenda a LEFT JOIN public.event e ON e.id = a.eventId
+			WHERE a.id = $1 AND a.deletedAt IS NOT NULL
+		`, id).Scan(&parentDeleted)
+		if err == sql.ErrNoRows {
+			return ErrNotInTrash
+		}
+		if err != nil {
+			return err
+		}
+		if parentDeleted {
+			return ErrParentInTrash
+		}
+
+		_, err = tx.Exec(`UPDATE public.agenda SET deletedAt = NULL WHERE id = $1`, id)
+	case "event":
+		var inTrash bool
+		err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM public.event WHERE id = $1 AND deletedAt IS NOT NULL)`, id).Scan(&inTrash)
+		if err != nil {
+			return err
+		}
+		if !inTrash {
+			return ErrNotInTrash
+		}
+
+		_, err = tx.Exec(`
+			UPDATE public.agenda SET deletedAt = NULL
+			WHERE eventId = $1 AND deletedAt = (SELECT deletedAt FROM public.event WHERE id = $1)
+		`, id)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`UPDATE public.event SET deletedAt = NULL WHERE id = $1`, id)
+	case "notification":
+		var res sql.Result
+		res, err = tx.Exec(`UPDATE public.notifications SET deletedAt = NULL WHERE id = $1 AND deletedAt IS NOT NULL`, id)
+		if err != nil {
+			return err
+		}
+		if affected, _ := res.RowsAffected(); affected == 0 {
+			return ErrNotInTrash
+		}
+	default:
+		return ErrNotInTrash
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ListTrash returns one page of everything in the trash, most recently deleted first
+func ListTrash(db *sql.DB, opts ListOptions) (Page[TrashItem], error) {
+	q := listQuery{
+		from: `(
+			SELECT 'agenda' AS type, id, title AS name, deletedAt FROM public.agenda WHERE deletedAt IS NOT NULL
+			UNION ALL
+			SELECT 'event', id, name, deletedAt FROM public.event WHERE deletedAt IS NOT NULL
+			UNION ALL
+			SELECT 'notification', id, title, deletedAt FROM public.notifications WHERE deletedAt IS NOT NULL
+		) trash`,
+		columns: "type, id, name, deletedAt",
+		sortable: map[string]string{
+			"deletedAt": "deletedAt",
+			"name":      "name",
+		},
+		filterable: map[string]string{
+			"type": "type",
+		},
+		defaultSort: "deletedAt",
+		tiebreaker:  "id",
+	}
+
+	if opts.Sort == "" {
+		opts.Desc = true
+	}
+
+	retention := TrashRetention()
+	return runList(db, q, opts, nil, nil, func(rows *sql.Rows) (TrashItem, error) {
+		var item TrashItem
+		err := rows.Scan(&item.Type, &item.ID, &item.Name, &item.DeletedAt)
+		item.PurgeAt = item.DeletedAt.Add(retention)
+		return item, err
+	})
+}
+
+// PurgeTrash permanently deletes everything that went into the trash before the
+// cutoff, along with the follows, finalists and schedules of purged events. Notifications
+// using a purged event for their placeholders lose it (the foreign key sets it to null).
+func PurgeTrash(db *sql.DB, cutoff time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	statements := []string{
+		`DELETE FROM public.user_agenda WHERE eventId IN (SELECT id FROM public.event WHERE deletedAt < $1)`,
+		`DELETE FROM public.user_event WHERE eventId IN (SELECT id FROM public.event WHERE deletedAt < $1)`,
+		`DELETE FROM public.finalists WHERE eventid IN (SELECT id FROM public.event WHERE deletedAt < $1)`,
+		`DELETE FROM public.agenda WHERE eventId IN (SELECT id FROM public.event WHERE deletedAt < $1)`,
+		`DELETE FROM public.event WHERE deletedAt < $1`,
+		`DELETE FROM public.agenda WHERE deletedAt < $1`,
+		`DELETE FROM public.notifications WHERE deletedAt < $1`,
+	}
+
+	for _, statement := range statements {
+		if _, err := tx.Exec(statement, cutoff); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -15,6 +15,7 @@ type Agenda struct {
 	Location    string    `json:"location"`
 	Icon        []byte    `json:"icon,omitempty"`
 	Published   bool      `json:"published"`
+	PublishAt   *time.Time `json:"publishAt,omitempty"` // When set the item is published automatically at this time
 	CreatedAt   time.Time `json:"createdAt"`
 }
 
@@ -27,9 +28,22 @@ type Notification struct {
 	Published   bool	  `json:"published"`
 
 	// Optional fields
-	Private   bool      `json:"private"` // If true, only certain users can see it
-	UserIDS   []string  `json:"userids,omitempty"` // List of user IDs that can see this notification
+	Private   bool      `json:"private"` // If true, only certain users can see it, kept in step with Targets
+	UserIDS   []string  `json:"userids,omitempty"` // Old way of targeting user, school or event ids, only accepted as input
+	Targets   []Target  `json:"targets,omitempty"` // Who the notification is for
 	Type 	  string    `json:"type,omitempty"`    // Type of notification (e.g., "info", "alert", etc.)
+	PublishAt *time.Time `json:"publishAt,omitempty"` // When set the notification is published and sent at this time
+	Status    string    `json:"status,omitempty"`    // Where it is in the approval workflow (draft, pending, approved, rejected, sent)
+	CreatedBy string    `json:"createdBy,omitempty"` // The admin that created it
+	EventID   string    `json:"eventId,omitempty"`   // Event used to fill in {{event.*}} placeholders
+	ClearedAt *time.Time `json:"clearedAt,omitempty"` // When an emergency was declared over
+	Link      *Link     `json:"link,omitempty"`      // What opens when the notification is tapped
+	ImageURL  string    `json:"imageUrl,omitempty"`  // Image attached to the push
+	Category  string    `json:"category,omitempty"`  // Action buttons shown with the push, like ADD_TO_AGENDA
+	RetractedAt *time.Time `json:"retractedAt,omitempty"` // When it was pulled back after being sent
+	CorrectsID string   `json:"correctsId,omitempty"` // The notification this is a correction of
+	Channels  []string  `json:"channels,omitempty"`  // push and/or email, push when empty
+	Read      *bool     `json:"read,omitempty"`      // Whether the user asking has read it, only set in /user/notifications
 
 	CreatedAt   time.Time `json:"createdAt"`
 }
@@ -39,6 +53,7 @@ type ApiKey struct {
 	Key       	string    	`json:"key"`
 	Purpose 	string  	`json:"purpose"`
 	CreatedAt 	time.Time 	`json:"createdAt"`
+	AdminName	string		`json:"-"` // The full name of the admin the key belongs to, empty for backend keys
 }
 
 type Finalist struct {
@@ -61,6 +76,7 @@ type User struct {
 	ShortName string    `json:"shortName"`
 	FullName  string    `json:"fullName"`
 	SchoolID  string `json:"school_id"`
+	Role      string `json:"role"`
 }
 
 type School struct {
@@ -0,0 +1,40 @@
+package database
+
+import (
+	"database/sql"
+)
+
+// DeviceWeb is the device type of browsers subscribed to web push
+const DeviceWeb = "web"
+
+// VAPIDKeys are the key pair web pushes are signed with
+type VAPIDKeys struct {
+	Public  string
+	Private string
+}
+
+// EnsureVAPIDKeys returns the stored VAPID keys, storing the given ones first if there
+// aren't any yet. Whichever replica gets there first wins, the rest get its keys.
+func EnsureVAPIDKeys(db *sql.DB, generated VAPIDKeys) (VAPIDKeys, error) {
+	_, err := db.Exec(`
+		INSERT INTO public.vapid_keys (id, publicKey, privateKey) VALUES (1, $1, $2)
+		ON CONFLICT (id) DO NOTHING
+	`, generated.Public, generated.Private)
+	if err != nil {
+		return VAPIDKeys{}, err
+	}
+
+	var keys VAPIDKeys
+	err = db.QueryRow(`SELECT publicKey, privateKey FROM public.vapid_keys WHERE id = 1`).Scan(&keys.Public, &keys.Private)
+	return keys, err
+}
+
+// GetWebSubscriptionKeys returns the encryption keys of the web push subscription with the endpoint
+func GetWebSubscriptionKeys(db *sql.DB, endpoint string) (p256dh string, auth string, err error) {
+	err = db.QueryRow(`
+		SELECT COALESCE(webP256dh, ''), COALESCE(webAuth, '') FROM public.devices
+		WHERE token = $1 AND deviceType = '`+DeviceWeb+`'
+	`, endpoint).Scan(&p256dh, &auth)
+
+	return p256dh, auth, err
+}
@@ -0,0 +1,531 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"prorickey/nctsa/database"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+/*
+Background jobs that must only happen once no matter how many replicas of the
+backend are running (scheduled pushes, purges, reminders...). Jobs are rows in
+the jobs table, either recurring on a schedule or one-shot at a time.
+
+Every replica runs the loop below, but only the one holding the leader lock in
+redis looks for due jobs. A job's redis lock is taken before it is claimed, so
+even during a leader hand-off a job can't run twice at once, and a job that is
+still running is left due until it finishes rather than being dropped. Claiming
+moves its runAt forward in the same UPDATE.
+
+One-shot jobs that fail are tried again with backoff, up to maxAttempts times.
+Recurring jobs just wait for their next run.
+
+Work that every replica has to do for itself, like loading the in-memory cache,
+doesn't belong here.
+*/
+
+// Job is the row handed to a handler when it is run
+type Job struct {
+	Name    string          `json:"name"`
+	Handler string          `json:"handler"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Attempt int             `json:"attempt,omitempty"` // Which try this is of a one-shot job, from 1
+}
+
+// Handler does the work of a job
+type Handler func(ctx context.Context, job Job) error
+
+// JobInfo is a job along with its last run, for the admin panel
+type JobInfo struct {
+	Name      string     `json:"name"`
+	Handler   string     `json:"handler"`
+	Schedule  string     `json:"schedule,omitempty"`
+	RunAt     *time.Time `json:"runAt,omitempty"`
+	Enabled   bool       `json:"enabled"`
+	LastRunAt *time.Time `json:"lastRunAt,omitempty"`
+	LastRun   *Run       `json:"lastRun,omitempty"`
+}
+
+// Run is one run of a job
+type Run struct {
+	ID         int64      `json:"id"`
+	JobName    string     `json:"jobName"`
+	Instance   string     `json:"instance"`
+	Status     string     `json:"status"` // "running", "succeeded" or "failed"
+	Error      string     `json:"error,omitempty"`
+	StartedAt  time.Time  `json:"startedAt"`
+	FinishedAt *time.Time `json:"finishedAt,omitempty"`
+}
+
+const (
+	pollInterval = 5 * time.Second
+	leaderTTL    = 30 * time.Second
+	jobTimeout   = 10 * time.Minute
+	leaderKey    = "JOBS:LEADER"
+	retryBase    = 30 * time.Second
+	maxAttempts  = 8
+)
+
+var (
+	handlers sync.Map
+	instance = instanceName()
+
+	ErrUnknownJob = errors.New("unknown job")
+)
+
+// renewScript extends a lock only if we still hold it
+var renewScript = redis.NewScript(`
+	if redis.call("GET", KEYS[1]) == ARGV[1] then
+		return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	end
+	return 0
+`)
+
+// releaseScript removes a lock only if we still hold it
+var releaseScript = redis.NewScript(`
+	if redis.call("GET", KEYS[1]) == ARGV[1] then
+		return redis.call("DEL", KEYS[1])
+	end
+	return 0
+`)
+
+func instanceName() string {
+	host, _ := os.Hostname()
+	return fmt.Sprintf("%s-%s", host, uuid.NewString()[:8])
+}
+
+// Register makes a handler available to jobs by name. Handlers have to be registered
+// on every replica before Start is called.
+func Register(name string, handler Handler) {
+	handlers.Store(name, handler)
+}
+
+// Recurring creates or updates a recurring job. The job keeps its enabled state and
+// next run if it already exists with the same schedule.
+func Recurring(db *sql.DB, name string, handler string, spec string, payload any) error {
+	schedule, err := ParseSchedule(spec)
+	if err != nil {
+		return err
+	}
+
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO public.jobs (name, handler, schedule, runAt, payload)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (name) DO UPDATE SET
+			handler = EXCLUDED.handler,
+			payload = EXCLUDED.payload,
+			runAt = CASE WHEN jobs.schedule IS DISTINCT FROM EXCLUDED.schedule OR jobs.runAt IS NULL
+				THEN EXCLUDED.runAt ELSE jobs.runAt END,
+			schedule = EXCLUDED.schedule
+	`, name, handler, spec, schedule.Next(time.Now()), string(raw))
+
+	return err
+}
+
+// Enqueue creates a job that runs once at the given time. Enqueuing a job with the
+// same name again replaces it, which makes it easy to push a pending job back.
+func Enqueue(db *sql.DB, name string, handler string, runAt time.Time, payload any) error {
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Exec(`
+		INSERT INTO public.jobs (name, handler, schedule, runAt, payload, enabled)
+		VALUES ($1, $2, NULL, $3, $4, true)
+		ON CONFLICT (name) DO UPDATE SET
+			handler = EXCLUDED.handler,
+			schedule = NULL,
+			runAt = EXCLUDED.runAt,
+			payload = EXCLUDED.payload,
+			enabled = true,
+			attempts = 0
+	`, name, handler, runAt, string(raw))
+
+	return err
+}
+
+// EnqueueMerged creates or pushes back a one-shot job like Enqueue, building its payload
+// and run time from the payload the job is still waiting with (nil if it isn't pending).
+// Concurrent calls for the same job take turns, even across replicas, so none of them
+// loses what another merged in.
+func EnqueueMerged(db *sql.DB, name string, handler string, merge func(pending json.RawMessage) (any, time.Time, error)) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The job may not exist yet so there's no row to lock, the lock on the name covers both
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext('jobs:' || $1))`, name); err != nil {
+		return err
+	}
+
+	var pending []byte
+	err = tx.QueryRow(`SELECT payload FROM public.jobs WHERE name = $1 AND schedule IS NULL AND runAt IS NOT NULL`, name).Scan(&pending)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	payload, runAt, err := merge(pending)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO public.jobs (name, handler, schedule, runAt, payload, enabled)
+		VALUES ($1, $2, NULL, $3, $4, true)
+		ON CONFLICT (name) DO UPDATE SET
+			handler = EXCLUDED.handler,
+			schedule = NULL,
+			runAt = EXCLUDED.runAt,
+			payload = EXCLUDED.payload,
+			enabled = true,
+			attempts = 0
+	`, name, handler, runAt, string(raw))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Cancel stops a one-shot job from running, returns false if it wasn't pending
+func Cancel(db *sql.DB, name string) (bool, error) {
+	res, err := db.Exec(`UPDATE public.jobs SET runAt = NULL WHERE name = $1 AND schedule IS NULL AND runAt IS NOT NULL`, name)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := res.RowsAffected()
+	return affected > 0, err
+}
+
+// RunNow makes a job due straight away
+func RunNow(db *sql.DB, name string) error {
+	res, err := db.Exec(`UPDATE public.jobs SET runAt = CURRENT_TIMESTAMP WHERE name = $1`, name)
+	if err != nil {
+		return err
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return ErrUnknownJob
+	}
+
+	return nil
+}
+
+// Start runs the job loop on this replica
+func Start(db *sql.DB, rdb *redis.Client) {
+	go func() {
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if !holdLeadership(rdb) {
+				continue
+			}
+			runDue(db, rdb)
+		}
+	}()
+}
+
+// holdLeadership takes or renews the leader lock, returns true if this replica is the leader
+func holdLeadership(rdb *redis.Client) bool {
+	ctx := context.Background()
+
+	renewed, err := renewScript.Run(ctx, rdb, []string{leaderKey}, instance, leaderTTL.Milliseconds()).Int()
+	if err == nil && renewed == 1 {
+		return true
+	}
+
+	acquired, err := rdb.SetNX(ctx, leaderKey, instance, leaderTTL).Result()
+	if err != nil {
+		log.Printf("Error taking job leader lock: %v", err)
+		return false
+	}
+	if acquired {
+		log.Printf("Instance %s is now running background jobs", instance)
+	}
+
+	return acquired
+}
+
+// runDue claims and starts every job that is due
+func runDue(db *sql.DB, rdb *redis.Client) {
+	rows, err := db.Query(`
+		SELECT name, handler, COALESCE(schedule, ''), payload
+		FROM public.jobs
+		WHERE enabled AND runAt <= CURRENT_TIMESTAMP
+		ORDER BY runAt
+	`)
+	if err != nil {
+		log.Printf("Error querying due jobs: %v", err)
+		return
+	}
+
+	type dueJob struct {
+		job  Job
+		spec string
+	}
+	due := make([]dueJob, 0)
+	for rows.Next() {
+		var d dueJob
+		var payload []byte
+		if err := rows.Scan(&d.job.Name, &d.job.Handler, &d.spec, &payload); err != nil {
+			log.Printf("Error scanning due job: %v", err)
+			continue
+		}
+		d.job.Payload = payload
+		due = append(due, d)
+	}
+	rows.Close()
+
+	for _, d := range due {
+		// Locked first, a job that is still running stays due and is picked up once it's done
+		if !lock(rdb, d.job.Name) {
+			continue
+		}
+
+		attempt, ok := claim(db, d.job.Name, d.spec)
+		if !ok {
+			unlock(rdb, d.job.Name)
+			continue
+		}
+		d.job.Attempt = attempt
+
+		go run(db, rdb, d.job)
+	}
+}
+
+func lockKey(name string) string {
+	return "JOBS:LOCK:" + name
+}
+
+// lock takes the job's lock, returns false if it is already running somewhere
+func lock(rdb *redis.Client, name string) bool {
+	locked, err := rdb.SetNX(context.Background(), lockKey(name), instance, jobTimeout).Result()
+	if err != nil {
+		log.Printf("Error locking job %s: %v", name, err)
+		return false
+	}
+	return locked
+}
+
+func unlock(rdb *redis.Client, name string) {
+	releaseScript.Run(context.Background(), rdb, []string{lockKey(name)}, instance)
+}
+
+// claim moves the job's next run forward, only one caller can claim each due run. One-shot
+// jobs count the attempt, which is returned.
+func claim(db *sql.DB, name string, spec string) (int, bool) {
+	var next *time.Time
+	if spec != "" {
+		schedule, err := ParseSchedule(spec)
+		if err != nil {
+			log.Printf("Job %s has an invalid schedule: %v", name, err)
+			return 0, false
+		}
+		n := schedule.Next(time.Now())
+		next = &n
+	}
+
+	var attempts int
+	err := db.QueryRow(`
+		UPDATE public.jobs SET runAt = $2, lastRunAt = CURRENT_TIMESTAMP,
+			attempts = CASE WHEN schedule IS NULL THEN attempts + 1 ELSE 0 END
+		WHERE name = $1 AND enabled AND runAt <= CURRENT_TIMESTAMP
+		RETURNING attempts
+	`, name, next).Scan(&attempts)
+	if err == sql.ErrNoRows {
+		// Someone else got to it first
+		return 0, false
+	}
+	if err != nil {
+		log.Printf("Error claiming job %s: %v", name, err)
+		return 0, false
+	}
+
+	return attempts, true
+}
+
+// run runs a claimed job, whose lock is already held, and records the run
+func run(db *sql.DB, rdb *redis.Client, job Job) {
+	defer unlock(rdb, job.Name)
+
+	ctx, cancel := context.WithTimeout(context.Background(), jobTimeout)
+	defer cancel()
+
+	var runID int64
+	err := db.QueryRow(`INSERT INTO public.job_runs (jobName, instance, status) VALUES ($1, $2, 'running') RETURNING id`, job.Name, instance).Scan(&runID)
+	if err != nil {
+		log.Printf("Error recording run of job %s: %v", job.Name, err)
+	}
+
+	err = invoke(ctx, job)
+
+	status, message := "succeeded", ""
+	if err != nil {
+		status, message = "failed", err.Error()
+		log.Printf("Job %s failed: %v", job.Name, err)
+		retry(db, job)
+	}
+
+	if runID != 0 {
+		_, err = db.Exec(`UPDATE public.job_runs SET status = $2, error = NULLIF($3, ''), finishedAt = CURRENT_TIMESTAMP WHERE id = $1`, runID, status, message)
+		if err != nil {
+			log.Printf("Error recording result of job %s: %v", job.Name, err)
+		}
+	}
+}
+
+// retry schedules a failed one-shot job to run again, waiting twice as long each time. It is
+// left alone if it was enqueued again while running, that run comes first.
+func retry(db *sql.DB, job Job) {
+	if job.Attempt == 0 {
+		// Recurring, it runs again on schedule
+		return
+	}
+	if job.Attempt >= maxAttempts {
+		log.Printf("Giving up on job %s after %d tries", job.Name, job.Attempt)
+		return
+	}
+
+	_, err := db.Exec(`UPDATE public.jobs SET runAt = $2 WHERE name = $1 AND schedule IS NULL AND runAt IS NULL`,
+		job.Name, time.Now().Add(retryDelay(job.Attempt)))
+	if err != nil {
+		log.Printf("Error scheduling another try of job %s: %v", job.Name, err)
+	}
+}
+
+// retryDelay is how long to wait after the given failed attempt
+func retryDelay(attempt int) time.Duration {
+	return retryBase << (attempt - 1)
+}
+
+// invoke calls the job's handler, turning a panic into an error so one bad job can't take the server down
+func invoke(ctx context.Context, job Job) (err error) {
+	val, ok := handlers.Load(job.Handler)
+	if !ok {
+		return fmt.Errorf("no handler registered for %q", job.Handler)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return val.(Handler)(ctx, job)
+}
+
+// ListJobs returns every job with its most recent run
+func ListJobs(db *sql.DB) ([]JobInfo, error) {
+	rows, err := db.Query(`
+		SELECT j.name, j.handler, COALESCE(j.schedule, ''), j.runAt, j.enabled, j.lastRunAt,
+			r.id, r.instance, r.status, r.error, r.startedAt, r.finishedAt
+		FROM public.jobs j
+		LEFT JOIN LATERAL (
+			SELECT * FROM public.job_runs WHERE jobName = j.name ORDER BY startedAt DESC LIMIT 1
+		) r ON true
+		ORDER BY j.schedule IS NULL, j.name
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	infos := make([]JobInfo, 0)
+	for rows.Next() {
+		var info JobInfo
+		var runAt, lastRunAt, startedAt, finishedAt sql.NullTime
+		var runID sql.NullInt64
+		var runInstance, runStatus, runError sql.NullString
+		err := rows.Scan(&info.Name, &info.Handler, &info.Schedule, &runAt, &info.Enabled, &lastRunAt,
+			&runID, &runInstance, &runStatus, &runError, &startedAt, &finishedAt)
+		if err != nil {
+			return infos, err
+		}
+
+		info.RunAt = database.TimePtr(runAt)
+		info.LastRunAt = database.TimePtr(lastRunAt)
+		if runID.Valid {
+			info.LastRun = &Run{
+				ID:         runID.Int64,
+				JobName:    info.Name,
+				Instance:   runInstance.String,
+				Status:     runStatus.String,
+				Error:      runError.String,
+				StartedAt:  startedAt.Time,
+				FinishedAt: database.TimePtr(finishedAt),
+			}
+		}
+		infos = append(infos, info)
+	}
+
+	return infos, rows.Err()
+}
+
+// ListRuns returns the most recent runs of a job
+func ListRuns(db *sql.DB, name string, limit int) ([]Run, error) {
+	rows, err := db.Query(`
+		SELECT id, jobName, instance, status, COALESCE(error, ''), startedAt, finishedAt
+		FROM public.job_runs
+		WHERE jobName = $1
+		ORDER BY startedAt DESC
+		LIMIT $2
+	`, name, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := make([]Run, 0)
+	for rows.Next() {
+		var r Run
+		var finishedAt sql.NullTime
+		if err := rows.Scan(&r.ID, &r.JobName, &r.Instance, &r.Status, &r.Error, &r.StartedAt, &finishedAt); err != nil {
+			return runs, err
+		}
+		r.FinishedAt = database.TimePtr(finishedAt)
+		runs = append(runs, r)
+	}
+
+	return runs, rows.Err()
+}
+
+// PruneRuns removes run history older than the cutoff
+func PruneRuns(db *sql.DB, cutoff time.Time) error {
+	_, err := db.Exec(`DELETE FROM public.job_runs WHERE startedAt < $1`, cutoff)
+	return err
+}
+
+// PruneFinished removes one-shot jobs that last ran before the cutoff and aren't due
+// again, along with their runs
+func PruneFinished(db *sql.DB, cutoff time.Time) (int64, error) {
+	res, err := db.Exec(`DELETE FROM public.jobs WHERE schedule IS NULL AND runAt IS NULL AND COALESCE(lastRunAt, createdAt) < $1`, cutoff)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
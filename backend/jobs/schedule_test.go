@@ -0,0 +1,138 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+)
+
+func at(value string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04:05", value)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestScheduleNext(t *testing.T) {
+	// 2025-03-31 is a Monday
+	tests := []struct {
+		spec  string
+		after string
+		want  string
+	}{
+		{"@every 15s", "2025-03-31 14:00:00", "2025-03-31 14:00:15"},
+		{"@every 1h30m", "2025-03-31 14:00:00", "2025-03-31 15:30:00"},
+		{"* * * * *", "2025-03-31 14:00:30", "2025-03-31 14:01:00"},
+		{"*/15 * * * *", "2025-03-31 14:07:30", "2025-03-31 14:15:00"},
+		{"*/15 * * * *", "2025-03-31 14:45:00", "2025-03-31 15:00:00"},
+		{"0 * * * *", "2025-03-31 14:00:00", "2025-03-31 15:00:00"},
+		{"30 3 * * *", "2025-03-31 14:00:00", "2025-04-01 03:30:00"},
+		{"0 9-17 * * *", "2025-03-31 17:30:00", "2025-04-01 09:00:00"},
+		{"0 9,12 * * *", "2025-03-31 09:00:00", "2025-03-31 12:00:00"},
+		{"5/20 * * * *", "2025-03-31 14:26:00", "2025-03-31 14:45:00"},
+		{"0 0 1 * *", "2025-03-31 14:00:00", "2025-04-01 00:00:00"},
+		{"0 0 31 * *", "2025-04-01 00:00:00", "2025-05-31 00:00:00"},
+		{"0 0 1 1 *", "2025-03-31 14:00:00", "2026-01-01 00:00:00"},
+		{"0 9 * * 1", "2025-03-31 09:00:00", "2025-04-07 09:00:00"},
+		{"0 9 * * 0", "2025-03-31 09:00:00", "2025-04-06 09:00:00"},
+		{"0 9 * * 1-5", "2025-04-04 09:00:00", "2025-04-07 09:00:00"},
+	}
+
+	for _, test := range tests {
+		schedule, err := ParseSchedule(test.spec)
+		if err != nil {
+			t.Errorf("ParseSchedule(%q) failed: %v", test.spec, err)
+			continue
+		}
+
+		if got := schedule.Next(at(test.after)); !got.Equal(at(test.want)) {
+			t.Errorf("%q after %s = %s, want %s", test.spec, test.after, got.Format(time.DateTime), test.want)
+		}
+	}
+}
+
+func TestScheduleDayFields(t *testing.T) {
+	tests := []struct {
+		name  string
+		spec  string
+		after string
+		want  []string
+	}{
+		{
+			// Both restricted, either one is enough
+			name:  "day of month or day of week",
+			spec:  "0 9 1 * 1",
+			after: "2025-03-30 12:00:00",
+			want:  []string{"2025-03-31 09:00:00", "2025-04-01 09:00:00", "2025-04-07 09:00:00", "2025-04-14 09:00:00"},
+		},
+		{
+			// A day field starting with * counts as unrestricted, so both have to match
+			name:  "stepped day of month and day of week",
+			spec:  "0 9 */2 * 1",
+			after: "2025-03-31 12:00:00",
+			want:  []string{"2025-04-07 09:00:00", "2025-04-21 09:00:00", "2025-05-05 09:00:00"},
+		},
+		{
+			name:  "only day of month",
+			spec:  "0 9 15 * *",
+			after: "2025-03-31 12:00:00",
+			want:  []string{"2025-04-15 09:00:00", "2025-05-15 09:00:00"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			schedule, err := ParseSchedule(test.spec)
+			if err != nil {
+				t.Fatalf("ParseSchedule(%q) failed: %v", test.spec, err)
+			}
+
+			next := at(test.after)
+			for _, want := range test.want {
+				next = schedule.Next(next)
+				if !next.Equal(at(want)) {
+					t.Fatalf("%q ran at %s, want %s", test.spec, next.Format(time.DateTime), want)
+				}
+			}
+		})
+	}
+}
+
+func TestScheduleNeverMatches(t *testing.T) {
+	schedule, err := ParseSchedule("0 0 31 2 *")
+	if err != nil {
+		t.Fatalf("ParseSchedule failed: %v", err)
+	}
+
+	if next := schedule.Next(at("2025-03-31 14:00:00")); !next.IsZero() {
+		t.Errorf("February 31st ran at %s, want never", next.Format(time.DateTime))
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	specs := []string{
+		"",
+		"@every",
+		"@every soon",
+		"@every 0s",
+		"@every -5m",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 7",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"5-1 * * * *",
+		"a * * * *",
+		"1-x * * * *",
+	}
+
+	for _, spec := range specs {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("ParseSchedule(%q) should have failed", spec)
+		}
+	}
+}
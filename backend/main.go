@@ -4,9 +4,14 @@ import (
 	"log"
 	"os"
 	"prorickey/nctsa/database"
+	"prorickey/nctsa/jobs"
+	"prorickey/nctsa/notifications"
 	"prorickey/nctsa/routes"
 	"prorickey/nctsa/routes/admin"
 	"prorickey/nctsa/routes/client"
+	"prorickey/nctsa/scheduler"
+	"prorickey/nctsa/stream"
+	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -32,16 +37,31 @@ func main() {
 
 	defer db.Close()
 
+	// Every replica keeps its own cache, but background jobs only run on one of them
 	database.StartCachingScheduler(db)
+	scheduler.RegisterJobs(db)
+	jobs.Start(db, rdb)
+	notifications.StartWorkers(db)
+	stream.Start(db, rdb)
 
 	router := gin.New()
 
+	// Only take the client ip from X-Forwarded-For when the request comes through one of
+	// our proxies, otherwise anyone could put whatever they like in the audit log
+	var proxies []string
+	if trusted := os.Getenv("TRUSTED_PROXIES"); trusted != "" {
+		proxies = strings.Split(trusted, ",")
+	}
+	if err := router.SetTrustedProxies(proxies); err != nil {
+		log.Fatalf("Invalid TRUSTED_PROXIES: %v", err)
+	}
+
 	// CORS configuration
 	// TODO: Set up cors the proper way
     config := cors.Config{
         AllowOrigins:     []string{"*"},
         AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-        AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
+        AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "Last-Event-ID"},
         ExposeHeaders:    []string{"Content-Length"},
         AllowCredentials: true,
         MaxAge: 12 * time.Hour,
@@ -50,6 +70,7 @@ func main() {
     // Use the CORS middleware with the configuration
     router.Use(cors.New(config))
 
+	router.Use(StreamTokenMiddleware())
 	router.Use(gin.Logger())
 	router.Use(gin.Recovery())
 	router.Use(func(c *gin.Context) {
@@ -62,11 +83,12 @@ func main() {
 	router.POST("/login", routes.PostLogin)
 	router.POST("/token", routes.PostCreateShortToken)
 	router.POST("/token/refresh", routes.PostRefreshToken)
+	router.GET("/status", routes.GetStatus)
 
 	// ApiAuthMiddleware is a middleware that checks if the client is authorized
 	// This is for the api within the backend. Used by the management dashboard.
 	authorized := router.Group("/admin")
-	authorized.Use(ApiAuthMiddleware()) 
+	authorized.Use(ApiAuthMiddleware())
 	{
 		authorized.GET("/agenda", admin.GetAgendaAdmin)
 		authorized.POST("/agenda", admin.PostAgenda)
@@ -75,17 +97,48 @@ func main() {
 		
 		authorized.GET("/notifications", admin.GetNotifications)
 		authorized.POST("/notifications", admin.PostNotifications)
+		authorized.POST("/notifications/audience", admin.PostNotificationAudience)
 		authorized.PUT("/notifications/:id", admin.UpdateNotification)
 		authorized.DELETE("/notifications/:id", admin.DeleteNotification)
+		authorized.GET("/notifications/:id/reviews", admin.GetNotificationReviews)
+		authorized.POST("/notifications/:id/approve", admin.PostApproveNotification)
+		authorized.POST("/notifications/:id/reject", admin.PostRejectNotification)
+		authorized.POST("/notifications/:id/comments", admin.PostNotificationComment)
+		authorized.POST("/notifications/:id/clear", admin.PostClearEmergency)
+		authorized.GET("/notifications/:id/progress", admin.GetNotificationProgress)
+		authorized.GET("/notifications/:id/deliveries", admin.GetNotificationDeliveries)
+		authorized.GET("/notifications/:id/reads", admin.GetNotificationReads)
+		authorized.POST("/notifications/:id/retract", admin.PostRetractNotification)
+		authorized.POST("/notifications/:id/correct", admin.PostCorrectNotification)
+
+		authorized.GET("/templates", admin.GetTemplates)
+		authorized.POST("/templates", admin.PostTemplate)
+		authorized.PUT("/templates/:id", admin.UpdateTemplate)
+		authorized.DELETE("/templates/:id", admin.DeleteTemplate)
+		authorized.POST("/templates/:id/preview", admin.PostPreviewTemplate)
 
 		authorized.GET("/events", admin.GetEventsAdmin)
 		authorized.POST("/events", admin.PostEvent)
 		authorized.PUT("/events/:id", admin.UpdateEvent)
+		authorized.GET("/events/:id/delete-preview", admin.GetEventDeletePreview)
 		authorized.DELETE("/events/:id", admin.DeleteEvent)
 
 		authorized.GET("/users", admin.GetUsers)
 		authorized.GET("/schools", admin.GetSchools)
 		authorized.GET("/s/events", admin.GetSearchEvents)
+		authorized.GET("/search", admin.GetSearch)
+
+		authorized.GET("/audit", admin.GetAuditLog)
+
+		authorized.GET("/trash", admin.GetTrash)
+		authorized.POST("/trash/:type/:id/restore", admin.PostRestoreFromTrash)
+
+		authorized.GET("/scheduled", admin.GetScheduled)
+		authorized.DELETE("/scheduled/:type/:id", admin.DeleteScheduled)
+
+		authorized.GET("/jobs", admin.GetJobs)
+		authorized.GET("/jobs/:name/runs", admin.GetJobRuns)
+		authorized.POST("/jobs/:name/run", admin.PostRunJob)
 	}
 	
 	// UserAuthMiddleware is a middleware that checks if the user is authenticated
@@ -94,13 +147,25 @@ func main() {
 	user.Use(UserAuthMiddleware(rdb)) 
 	{
 		user.GET("/ping", client.GetPing)
+		user.GET("/stream", client.GetStream)
 		user.POST("/device", client.RegisterDevice)
+		user.DELETE("/device", client.DeleteDevice)
+		user.GET("/device/webpush-key", client.GetWebPushKey)
 		user.GET("/notifications", client.GetNotifications)
+		user.GET("/notifications/unread", client.GetUnreadCount)
+		user.POST("/notifications/read", client.PostReadAllNotifications)
+		user.POST("/notifications/:id/read", client.PostNotificationRead)
 		
 		user.GET("/agenda", client.GetAgenda)
 		user.GET("/agenda/events", client.GetUserAgendaEvents)
 		user.POST("/agenda/events", client.PostAddEventToUserAgenda)
 		user.DELETE("/agenda/events/:id", client.DeleteRemoveEventFromUserAgenda)
+		user.GET("/agenda/favorites", client.GetFavorites)
+		user.POST("/agenda/favorites", client.PostFavorite)
+		user.DELETE("/agenda/favorites/:id", client.DeleteFavorite)
+
+		user.GET("/preferences", client.GetPreferences)
+		user.PUT("/preferences", client.PutPreferences)
 
 		user.GET("/events", client.GetEvents)
 		user.GET("/events/:id/schedules", client.GetEventSchedules) 
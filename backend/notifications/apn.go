@@ -1,83 +1,186 @@
 package notifications
 
 import (
-	"database/sql"
-	"log"
+	"context"
+	"net/http"
 	"os"
-
-	"prorickey/nctsa/database"
+	"sync"
 
 	"github.com/sideshow/apns2"
 	"github.com/sideshow/apns2/certificate"
 	"github.com/sideshow/apns2/payload"
+	"github.com/sideshow/apns2/token"
+)
+
+const (
+	defaultAPNsTopic = "com.northcarolinatsa.ios"
+
+	EnvironmentProduction = "production"
+	EnvironmentSandbox    = "sandbox"
 )
 
-func SendNotification(db *sql.DB, noti database.Notification) {
-    // Load the APNs certificate
-    file := "./apn.p12"
-    if os.Getenv("DEPLOY") == "release" {
-        file = "/root/apn.p12" // Path to the certificate in the deployed environment
-    }
-    cert, err := certificate.FromP12File(file, os.Getenv("APN_PASS"))
-    if err != nil {
-        log.Fatalf("Cert Error: %v", err)
-    }
-
-    // Create the APNs client
-    client := apns2.NewClient(cert).Production()
-
-    // Create the notification payload
-    p := payload.NewPayload().AlertTitle(noti.Title).AlertBody(noti.Description).Sound("default")
-    p.MutableContent()
-    p.Custom("notificationID", noti.ID)
-    p.Custom("type", noti.Type)
-
-    // Create the APNs notification
-    notification := &apns2.Notification{
-        Payload: p,
-        Topic:   "com.northcarolinatsa.ios",
-    }
-
-    log.Printf("Notification: %+v", notification) // Log the notification for debugging purposes
-
-    if noti.Private {
-        // Send notification to each user ID
-        for _, userID := range noti.UserIDS {
-            log.Printf("Sending private notification to user ID: %s", userID) // Log the user ID being used
-            tokens, err := database.GetDeviceToken(db, userID)
-            if err != nil {
-                log.Printf("Error retrieving device token for user %s: %v", userID, err)
-                continue
-            }
-            for _, tok := range tokens {
-                notification.DeviceToken = tok
-                res, err := client.Push(notification)
-                if err != nil {
-                    log.Printf("Error sending notification to %s: %v", userID, err)
-                } else {
-                    log.Printf("Sent notification to %s: %v", userID, res)
-                }
-            }
-        }
-    } else {
-        // Send notification to all devices (public notification)
-        tokens, err := database.GetAllAppleDeviceTokens(db)
-        log.Printf("Retrieved %d device tokens for public notification", len(tokens))
-        log.Printf("Tokens : %v", tokens) // Log the tokens for debugging purposes
-        if err != nil {
-            log.Printf("Error retrieving device tokens: %v", err)
-            return
-        }
-
-        for _, token := range tokens {
-            log.Printf("Sending notification to token: %s", token) // Log the token being used
-            notification.DeviceToken = token
-            res, err := client.Push(notification)
-            if err != nil {
-                log.Printf("Error sending notification to %s: %v", token, err)
-            } else {
-                log.Printf("Sent notification to %s: %v", token, res)
-            }
-        }
-    }
-}
\ No newline at end of file
+// apnsTopic is the bundle id pushes are sent to, set with APN_TOPIC
+func apnsTopic() string {
+	if topic := os.Getenv("APN_TOPIC"); topic != "" {
+		return topic
+	}
+	return defaultAPNsTopic
+}
+
+// apnsProvider sends to ios devices through APNs. Devices from App Store and
+// TestFlight builds are on production, development builds are on the sandbox.
+type apnsProvider struct {
+	mu      sync.Mutex
+	clients map[string]*apns2.Client
+}
+
+/*
+getClient returns the client for the APNs environment, creating it the first time.
+With APN_KEY_ID and APN_TEAM_ID set it uses token auth with the .p8 key at
+APN_KEY_PATH, otherwise the old .p12 certificate. If the credentials can't be
+loaded the pushes are retried later.
+*/
+func (p *apnsProvider) getClient(environment string) (*apns2.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if environment != EnvironmentSandbox {
+		environment = EnvironmentProduction
+	}
+	if client, ok := p.clients[environment]; ok {
+		return client, nil
+	}
+
+	var client *apns2.Client
+	if os.Getenv("APN_KEY_ID") != "" {
+		authKey, err := token.AuthKeyFromFile(credentialPath("APN_KEY_PATH", "apn.p8"))
+		if err != nil {
+			return nil, err
+		}
+		client = apns2.NewTokenClient(&token.Token{
+			AuthKey: authKey,
+			KeyID:   os.Getenv("APN_KEY_ID"),
+			TeamID:  os.Getenv("APN_TEAM_ID"),
+		})
+	} else {
+		cert, err := certificate.FromP12File(credentialPath("APN_P12_PATH", "apn.p12"), os.Getenv("APN_PASS"))
+		if err != nil {
+			return nil, err
+		}
+		client = apns2.NewClient(cert)
+	}
+
+	if environment == EnvironmentSandbox {
+		client = client.Development()
+	} else {
+		client = client.Production()
+	}
+
+	if p.clients == nil {
+		p.clients = map[string]*apns2.Client{}
+	}
+	p.clients[environment] = client
+	return client, nil
+}
+
+// credentialPath is where a credential file is, the env var if it is set otherwise
+// next to the binary, or in /root when deployed
+func credentialPath(env string, name string) string {
+	if path := os.Getenv(env); path != "" {
+		return path
+	}
+	if os.Getenv("DEPLOY") == "release" {
+		return "/root/" + name
+	}
+	return "./" + name
+}
+
+// apnsNotification builds the APNs push for a message
+func apnsNotification(token string, msg Message) *apns2.Notification {
+	if msg.Silent {
+		return silentNotification(token, msg)
+	}
+
+	p := payload.NewPayload().AlertTitle(msg.Title).AlertBody(msg.Body).Sound("default")
+	p.MutableContent()
+	for key, value := range msg.Data {
+		p.Custom(key, value)
+	}
+	if msg.Link != nil {
+		p.Custom("link", msg.Link)
+	}
+	if msg.ImageURL != "" {
+		// The notification service extension downloads and attaches it
+		p.Custom("imageUrl", msg.ImageURL)
+	}
+	if msg.Category != "" {
+		p.Category(msg.Category)
+	}
+	if msg.Badge != nil {
+		p.Badge(*msg.Badge)
+	}
+
+	notification := &apns2.Notification{
+		DeviceToken: token,
+		Payload:     p,
+		Topic:       apnsTopic(),
+	}
+
+	if msg.Emergency {
+		emergencyAlert(notification, p)
+	}
+
+	return notification
+}
+
+func (p *apnsProvider) Push(ctx context.Context, device Device, msg Message) (string, error) {
+	client, err := p.getClient(device.Environment)
+	if err != nil {
+		return "", &pushError{reason: "credentials: " + err.Error(), retry: true}
+	}
+
+	res, err := client.PushWithContext(ctx, apnsNotification(device.Token, msg))
+	if err != nil {
+		// Couldn't reach APNs at all
+		return "", &pushError{reason: err.Error(), retry: true}
+	}
+	if res.Sent() {
+		return res.ApnsID, nil
+	}
+
+	retry := res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= http.StatusInternalServerError
+	invalid := res.StatusCode == http.StatusGone ||
+		res.Reason == apns2.ReasonBadDeviceToken || res.Reason == apns2.ReasonUnregistered
+	return res.ApnsID, &pushError{reason: res.Reason, status: res.StatusCode, retry: retry, invalidToken: invalid}
+}
+
+// silentNotification builds a background push, which has no alert and has to go at low priority
+func silentNotification(token string, msg Message) *apns2.Notification {
+	p := payload.NewPayload().ContentAvailable()
+	for key, value := range msg.Data {
+		p.Custom(key, value)
+	}
+
+	return &apns2.Notification{
+		DeviceToken: token,
+		Payload:     p,
+		Topic:       apnsTopic(),
+		PushType:    apns2.PushTypeBackground,
+		Priority:    apns2.PriorityLow,
+	}
+}
+
+// emergencyAlert makes the push break through focus modes and go out straight away. Critical
+// alerts also play through the mute switch but need Apple's entitlement, so they are only
+// used when APN_CRITICAL_ALERTS is true, otherwise it is sent as time sensitive.
+func emergencyAlert(notification *apns2.Notification, p *payload.Payload) {
+	notification.Priority = apns2.PriorityHigh
+	notification.PushType = apns2.PushTypeAlert
+
+	if os.Getenv("APN_CRITICAL_ALERTS") == "true" {
+		p.InterruptionLevel(payload.InterruptionLevelCritical).SoundName("default").SoundVolume(1.0)
+	} else {
+		p.InterruptionLevel(payload.InterruptionLevelTimeSensitive)
+	}
+	p.RelevanceScore(1.0)
+}
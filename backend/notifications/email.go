@@ -0,0 +1,229 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"strings"
+	"time"
+
+	"prorickey/nctsa/database"
+
+	"github.com/google/uuid"
+)
+
+/*
+Emails go through the same queue as pushes, as a device of type email whose
+token is the address. emailProvider sends them to the SMTP server in SMTP_HOST,
+which can be a local sink like MailHog when developing. A 5xx from the server
+means it won't take the address, which is recorded as bounced. Bounces that
+come back later as mail aren't seen.
+*/
+
+const defaultSMTPPort = "587"
+
+// emailProvider sends messages as email over SMTP, built the same as the pushes
+type emailProvider struct{}
+
+var emailHTML = htmltemplate.Must(htmltemplate.New("email").Parse(`<!DOCTYPE html>
+<html>
+<body style="font-family: -apple-system, Helvetica, Arial, sans-serif; color: #1c1c1e; max-width: 560px; margin: 0 auto; padding: 24px;">
+	{{if .Emergency}}<p style="background: #d70015; color: #fff; padding: 8px 12px; border-radius: 6px; font-weight: bold;">Emergency alert</p>{{end}}
+	<h2 style="margin-top: 0;">{{.Title}}</h2>
+	{{if .ImageURL}}<img src="{{.ImageURL}}" alt="" style="max-width: 100%; border-radius: 8px;">{{end}}
+	{{range .Paragraphs}}<p style="line-height: 1.5;">{{.}}</p>{{end}}
+	{{if .URL}}<p><a href="{{.URL}}" style="color: #0a84ff;">Open link</a></p>{{end}}
+	<p style="color: #8e8e93; font-size: 12px; margin-top: 32px;">Sent by the NCTSA conference app. You can mute these in the app's settings.</p>
+</body>
+</html>
+`))
+
+// smtpAddress is the host:port of the SMTP server
+func smtpAddress() (string, string) {
+	host := os.Getenv("SMTP_HOST")
+	port := os.Getenv("SMTP_PORT")
+	if port == "" {
+		port = defaultSMTPPort
+	}
+	return host, net.JoinHostPort(host, port)
+}
+
+// emailSubject is the subject line of the email for a message
+func emailSubject(msg Message) string {
+	if msg.Emergency {
+		return "EMERGENCY: " + msg.Title
+	}
+	return msg.Title
+}
+
+// emailURL is where the email links to, only url links make sense outside the app
+func emailURL(msg Message) string {
+	if msg.Link != nil && msg.Link.Type == database.LinkURL {
+		return msg.Link.URL
+	}
+	return ""
+}
+
+// writeQuotedPrintable adds a part with the content encoded as quoted-printable
+func writeQuotedPrintable(writer *multipart.Writer, contentType string, content string) error {
+	part, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType + "; charset=utf-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return err
+	}
+
+	qp := quotedprintable.NewWriter(part)
+	if _, err := qp.Write([]byte(content)); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// buildEmail renders the message as a text and html email, returning it and its Message-ID
+func buildEmail(from string, to string, msg Message) ([]byte, string, error) {
+	url := emailURL(msg)
+
+	text := msg.Body
+	if url != "" {
+		text += "\n\n" + url
+	}
+
+	var html bytes.Buffer
+	err := emailHTML.Execute(&html, struct {
+		Message
+		Paragraphs []string
+		URL        string
+	}{msg, strings.Split(msg.Body, "\n\n"), url})
+	if err != nil {
+		return nil, "", err
+	}
+
+	domain := "nctsa"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = from[at+1:]
+	}
+	messageID := fmt.Sprintf("<%s@%s>", uuid.NewString(), domain)
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	if err := writeQuotedPrintable(writer, "text/plain", text); err != nil {
+		return nil, "", err
+	}
+	if err := writeQuotedPrintable(writer, "text/html", html.String()); err != nil {
+		return nil, "", err
+	}
+	if err := writer.Close(); err != nil {
+		return nil, "", err
+	}
+
+	var email bytes.Buffer
+	fmt.Fprintf(&email, "From: %s\r\n", from)
+	fmt.Fprintf(&email, "To: %s\r\n", to)
+	fmt.Fprintf(&email, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", emailSubject(msg)))
+	fmt.Fprintf(&email, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&email, "Message-ID: %s\r\n", messageID)
+	fmt.Fprintf(&email, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&email, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", writer.Boundary())
+	email.Write(body.Bytes())
+
+	return email.Bytes(), messageID, nil
+}
+
+// smtpError sorts out what a failed send means, 4xx replies are worth retrying and 5xx
+// replies to the recipient are a bounce
+func smtpError(err error, recipient bool) error {
+	var reply *textproto.Error
+	if errors.As(err, &reply) {
+		return &pushError{
+			reason:  fmt.Sprintf("smtp %d: %s", reply.Code, reply.Msg),
+			status:  reply.Code,
+			retry:   reply.Code < 500,
+			bounced: recipient && reply.Code >= 500,
+		}
+	}
+
+	// Couldn't talk to the server at all
+	return &pushError{reason: "smtp: " + err.Error(), retry: true}
+}
+
+func (p *emailProvider) Push(ctx context.Context, device Device, msg Message) (string, error) {
+	host, addr := smtpAddress()
+	if host == "" {
+		return "", &pushError{reason: "SMTP_HOST is not set"}
+	}
+	from := os.Getenv("SMTP_FROM")
+	if from == "" {
+		return "", &pushError{reason: "SMTP_FROM is not set"}
+	}
+
+	// Checked again here since the address goes in the headers, the queue could hold one from before it was checked
+	to, ok := database.ParseEmailAddress(device.Token)
+	if !ok {
+		return "", &pushError{reason: "invalid email address", bounced: true}
+	}
+
+	email, messageID, err := buildEmail(from, to, msg)
+	if err != nil {
+		return "", &pushError{reason: "building email: " + err.Error()}
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return "", smtpError(err, false)
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	client, err := smtp.NewClient(conn, host)
+	if err != nil {
+		conn.Close()
+		return "", smtpError(err, false)
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err := client.StartTLS(&tls.Config{ServerName: host}); err != nil {
+			return "", smtpError(err, false)
+		}
+	}
+	if username := os.Getenv("SMTP_USERNAME"); username != "" {
+		if err := client.Auth(smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)); err != nil {
+			return "", smtpError(err, false)
+		}
+	}
+
+	if err := client.Mail(from); err != nil {
+		return "", smtpError(err, false)
+	}
+	if err := client.Rcpt(to); err != nil {
+		return messageID, smtpError(err, true)
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return "", smtpError(err, false)
+	}
+	if _, err := writer.Write(email); err != nil {
+		return "", smtpError(err, false)
+	}
+	if err := writer.Close(); err != nil {
+		return "", smtpError(err, false)
+	}
+
+	client.Quit()
+	return messageID, nil
+}
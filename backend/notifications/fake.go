@@ -0,0 +1,55 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+
+	"prorickey/nctsa/database"
+)
+
+// FakePush is a push the fake provider was asked to send
+type FakePush struct {
+	Device  Device
+	Message Message
+}
+
+// FakeProvider records pushes instead of sending them. Fail and Bounce make the next
+// pushes to a token fail with the given error.
+type FakeProvider struct {
+	mu     sync.Mutex
+	Sent   []FakePush
+	errors map[string]error
+}
+
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{errors: map[string]error{}}
+}
+
+// Fail makes pushes to the token fail, retry and invalid decide what the queue does about it
+func (f *FakeProvider) Fail(token string, reason string, retry bool, invalid bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errors[token] = &pushError{reason: reason, retry: retry, invalidToken: invalid}
+}
+
+// Bounce makes emails to the address fail as if the mail server turned it down
+func (f *FakeProvider) Bounce(address string, reason string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.errors[address] = &pushError{reason: reason, status: 550, bounced: true}
+}
+
+func (f *FakeProvider) Push(ctx context.Context, device Device, msg Message) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if err, ok := f.errors[device.Token]; ok {
+		return "", err
+	}
+
+	f.Sent = append(f.Sent, FakePush{Device: device, Message: msg})
+	log.Printf("Fake push to %s: %s", database.MaskToken(device.Token), msg.Title)
+	return fmt.Sprintf("fake-%d", len(f.Sent)), nil
+}
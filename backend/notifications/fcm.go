@@ -0,0 +1,121 @@
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"firebase.google.com/go/v4/messaging"
+	fcm "github.com/appleboy/go-fcm"
+)
+
+// fcmProvider sends to android devices through Firebase Cloud Messaging
+type fcmProvider struct {
+	mu     sync.Mutex
+	client *fcm.Client
+}
+
+// getClient loads the service account the first time it is needed and reuses the client after that
+func (p *fcmProvider) getClient(ctx context.Context) (*fcm.Client, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.client != nil {
+		return p.client, nil
+	}
+
+	serviceAccountKeyPath := "./firebase.json"
+	if os.Getenv("DEPLOY") == "release" {
+		serviceAccountKeyPath = "/root/firebase.json"
+	}
+
+	client, err := fcm.NewClient(ctx, fcm.WithCredentialsFile(serviceAccountKeyPath))
+	if err != nil {
+		return nil, err
+	}
+
+	p.client = client
+	return client, nil
+}
+
+// fcmMessage builds the FCM message for a push, matching what ios gets
+func fcmMessage(token string, msg Message) *messaging.Message {
+	if msg.Silent {
+		// Data only messages are handed to the app without showing anything
+		return &messaging.Message{
+			Token:   token,
+			Data:    msg.Data,
+			Android: &messaging.AndroidConfig{Priority: "normal"},
+		}
+	}
+
+	message := &messaging.Message{
+		Token: token,
+		Notification: &messaging.Notification{
+			Title: msg.Title,
+			Body:  msg.Body,
+		},
+		Data: msg.Data,
+		Android: &messaging.AndroidConfig{
+			Priority: "normal",
+			Notification: &messaging.AndroidNotification{
+				Sound: "default",
+			},
+		},
+	}
+
+	// FCM data can only be strings, so the link goes in as json
+	if msg.Link != nil || msg.Category != "" {
+		message.Data = make(map[string]string, len(msg.Data)+2)
+		for key, value := range msg.Data {
+			message.Data[key] = value
+		}
+		if msg.Link != nil {
+			if link, err := json.Marshal(msg.Link); err == nil {
+				message.Data["link"] = string(link)
+			}
+		}
+		if msg.Category != "" {
+			message.Data["category"] = msg.Category
+			message.Android.Notification.ClickAction = msg.Category
+		}
+	}
+	message.Notification.ImageURL = msg.ImageURL
+	if msg.Badge != nil {
+		message.Android.Notification.NotificationCount = msg.Badge
+	}
+
+	if msg.Emergency {
+		// The app shows the emergency channel over do not disturb
+		message.Android.Priority = "high"
+		message.Android.Notification.ChannelID = "emergency"
+		message.Android.Notification.Priority = messaging.PriorityMax
+	}
+
+	return message
+}
+
+func (p *fcmProvider) Push(ctx context.Context, device Device, msg Message) (string, error) {
+	client, err := p.getClient(ctx)
+	if err != nil {
+		return "", &pushError{reason: "credentials: " + err.Error(), retry: true}
+	}
+
+	res, err := client.Send(ctx, fcmMessage(device.Token, msg))
+	if err != nil {
+		return "", &pushError{reason: err.Error(), retry: true}
+	}
+
+	result := res.Responses[0]
+	if result.Success {
+		return result.MessageID, nil
+	}
+
+	err = result.Error
+	return "", &pushError{
+		reason:       err.Error(),
+		retry:        messaging.IsUnavailable(err) || messaging.IsInternal(err) || messaging.IsQuotaExceeded(err),
+		invalidToken: messaging.IsUnregistered(err) || messaging.IsSenderIDMismatch(err),
+	}
+}
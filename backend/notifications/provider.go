@@ -0,0 +1,107 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"prorickey/nctsa/database"
+)
+
+// Device is where a push is going
+type Device struct {
+	Token       string
+	Environment string // production or sandbox, only used by APNs
+}
+
+// Provider sends a push to one device on one platform. Every provider gets the same
+// Message so a notification looks the same on every platform.
+type Provider interface {
+	// Push sends the message and returns the id the push service gave it. Errors
+	// should be a *pushError when the provider can tell if retrying will help.
+	Push(ctx context.Context, device Device, msg Message) (string, error)
+}
+
+var (
+	providersMu sync.RWMutex
+
+	// providers by devices.deviceType
+	providers = map[string]Provider{
+		"ios":     &apnsProvider{},
+		"android": &fcmProvider{},
+		"email":   &emailProvider{},
+	}
+)
+
+// SetProvider replaces the provider for a device type, for tests and local development
+func SetProvider(deviceType string, provider Provider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[deviceType] = provider
+}
+
+// providerFor returns the provider for a device type
+func providerFor(deviceType string) (Provider, error) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	provider, ok := providers[deviceType]
+	if !ok {
+		return nil, &pushError{reason: fmt.Sprintf("no push provider for %q devices", deviceType)}
+	}
+	return provider, nil
+}
+
+// UseFakeProviders swaps every provider for a fake when PUSH_PROVIDER is fake, so the
+// queue can be run locally without credentials
+func UseFakeProviders() {
+	if os.Getenv("PUSH_PROVIDER") != "fake" {
+		return
+	}
+
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	for deviceType := range providers {
+		// Email still goes out when there is an SMTP server set, so it can be pointed at a local sink
+		if deviceType == database.DeviceEmail && os.Getenv("SMTP_HOST") != "" {
+			continue
+		}
+		providers[deviceType] = NewFakeProvider()
+	}
+}
+
+// pushError is why a push didn't go out and whether it is worth trying again
+type pushError struct {
+	reason       string
+	status       int
+	retry        bool
+	invalidToken bool // The device is gone and shouldn't be pushed to again
+	bounced      bool // The email address was turned down
+}
+
+func (e *pushError) Error() string {
+	return e.reason
+}
+
+// retryable reports whether a failed push should be tried again
+func retryable(err error) bool {
+	var pushErr *pushError
+	if errors.As(err, &pushErr) {
+		return pushErr.retry
+	}
+	return true
+}
+
+// bounced reports whether a failed email was turned down for good by the mail server
+func bounced(err error) bool {
+	var pushErr *pushError
+	return errors.As(err, &pushErr) && pushErr.bounced
+}
+
+// invalidToken reports whether a failed push means the device token is dead
+func invalidToken(err error) bool {
+	var pushErr *pushError
+	return errors.As(err, &pushErr) && pushErr.invalidToken
+}
@@ -0,0 +1,315 @@
+package notifications
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"time"
+
+	"prorickey/nctsa/database"
+)
+
+/*
+Pushes don't go out from the request that publishes a notification. Sending a
+notification renders it for every device it reaches and puts those in the
+push_queue table, and a pool of workers on every replica sends them. Failed
+pushes are retried with backoff, and the admin panel can poll the progress.
+*/
+
+const (
+	defaultPushWorkers = 8
+	pushBatchSize      = 50
+	pushIdleInterval   = time.Second
+	maxPushAttempts    = 5
+	pushBackoffBase    = 5 * time.Second
+	pushBackoffMax     = 10 * time.Minute
+	pushTimeout        = 30 * time.Second
+)
+
+// Message is what a push says, the same for every platform
+type Message struct {
+	Title     string            `json:"title"`
+	Body      string            `json:"body"`
+	Data      map[string]string `json:"data,omitempty"`
+	Link      *database.Link    `json:"link,omitempty"`
+	ImageURL  string            `json:"imageUrl,omitempty"`
+	Category  string            `json:"category,omitempty"`
+	Emergency bool              `json:"emergency,omitempty"`
+	Badge     *int              `json:"badge,omitempty"` // The user's unread count, shown on the app icon
+	Silent    bool              `json:"silent,omitempty"` // Wakes the app in the background with the data, nothing is shown
+}
+
+// wake nudges the workers on this replica when something is queued, so they don't
+// wait out their idle interval
+var wake = make(chan struct{}, 1)
+
+// SendNotification renders the notification for each device it reaches and queues the pushes.
+// Users that muted its type or are in their quiet hours are skipped, they still see it in the app.
+func SendNotification(db *sql.DB, noti database.Notification) error {
+	notifType := noti.Type
+	if notifType == "" {
+		notifType = "general"
+	}
+
+	recipients := make([]database.DeviceRecipient, 0)
+	if noti.HasChannel(database.ChannelPush) {
+		devices, err := database.GetPushDevices(db, noti.Targets, notifType)
+		if err != nil {
+			return err
+		}
+		recipients = append(recipients, devices...)
+	}
+	if noti.HasChannel(database.ChannelEmail) {
+		// Emails are queued and retried alongside the pushes, the address stands in for the token
+		emails, err := database.GetEmailRecipients(db, noti.Targets, notifType)
+		if err != nil {
+			return err
+		}
+		recipients = append(recipients, emails...)
+	}
+
+	priority := 0
+	if noti.Type == database.TypeEmergency {
+		priority = database.PriorityEmergency
+	}
+
+	// The badge is each user's unread count, which this notification is now part of
+	userIDs := make([]string, 0, len(recipients))
+	for _, recipient := range recipients {
+		if recipient.UserID != "" && recipient.DeviceType != database.DeviceEmail {
+			userIDs = append(userIDs, recipient.UserID)
+		}
+	}
+	unread, unreadErr := database.UnreadCounts(db, userIDs)
+	if unreadErr != nil {
+		log.Printf("Error counting unread notifications, sending %s without badges: %v", noti.ID, unreadErr)
+	}
+
+	// Titles and descriptions can have placeholders, so the message is built for each recipient
+	renderer := NewRenderer(db, noti)
+	pushes := make([]database.Push, 0, len(recipients))
+	for _, recipient := range recipients {
+		title, description := renderer.For(recipient.UserID)
+
+		var badge *int
+		if count, ok := unread[recipient.UserID]; ok && unreadErr == nil && recipient.DeviceType != database.DeviceEmail {
+			badge = &count
+		}
+
+		msg, err := json.Marshal(Message{
+			Title: title,
+			Body:  description,
+			Data: map[string]string{
+				"notificationID": noti.ID,
+				"type":           noti.Type,
+			},
+			Link:      noti.Link,
+			ImageURL:  noti.ImageURL,
+			Category:  noti.Category,
+			Emergency: noti.Type == database.TypeEmergency,
+			Badge:     badge,
+		})
+		if err != nil {
+			return err
+		}
+
+		pushes = append(pushes, database.Push{
+			NotificationID: noti.ID,
+			UserID:         recipient.UserID,
+			Token:          recipient.Token,
+			DeviceType:     recipient.DeviceType,
+			Environment:    recipient.Environment,
+			Priority:       priority,
+			Message:        msg,
+		})
+	}
+
+	if err := queuePushes(db, pushes); err != nil {
+		return err
+	}
+	log.Printf("Queued notification %s for %d devices and addresses", noti.ID, len(pushes))
+
+	return nil
+}
+
+// queuePushes adds the pushes to the queue and wakes the workers on this replica
+func queuePushes(db *sql.DB, pushes []database.Push) error {
+	if err := database.EnqueuePushes(db, pushes); err != nil {
+		return err
+	}
+
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// pushWorkers is how many pushes each replica sends at once, set with PUSH_WORKERS
+func pushWorkers() int {
+	if workers, err := strconv.Atoi(os.Getenv("PUSH_WORKERS")); err == nil && workers > 0 {
+		return workers
+	}
+
+	return defaultPushWorkers
+}
+
+// StartWorkers starts the pool of workers sending the queued pushes
+func StartWorkers(db *sql.DB) {
+	SetProvider(database.DeviceWeb, &webPushProvider{db: db})
+	UseFakeProviders()
+
+	work := make(chan database.Push)
+
+	for i := 0; i < pushWorkers(); i++ {
+		go func() {
+			for push := range work {
+				deliver(db, push)
+			}
+		}()
+	}
+
+	// One loop claims batches and hands them to the workers, the unbuffered channel
+	// means it only claims more once they have caught up
+	go func() {
+		for {
+			pushes, err := database.ClaimPushes(db, pushBatchSize)
+			if err != nil {
+				log.Printf("Error claiming pushes: %v", err)
+			}
+
+			for _, push := range pushes {
+				work <- push
+			}
+
+			if len(pushes) < pushBatchSize {
+				select {
+				case <-wake:
+				case <-time.After(pushIdleInterval):
+				}
+			}
+		}
+	}()
+}
+
+// deliver sends one push and records how it went
+func deliver(db *sql.DB, push database.Push) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Panic sending push %d: %v", push.ID, r)
+			recordFailure(db, push, &pushError{reason: "panic", retry: true}, "")
+		}
+	}()
+
+	var msg Message
+	if err := json.Unmarshal(push.Message, &msg); err != nil {
+		recordFailure(db, push, &pushError{reason: "bad message: " + err.Error()}, "")
+		return
+	}
+
+	provider, err := providerFor(push.DeviceType)
+	if err != nil {
+		recordFailure(db, push, err, "")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), pushTimeout)
+	defer cancel()
+
+	apnsID, err := provider.Push(ctx, Device{Token: push.Token, Environment: push.Environment}, msg)
+	if err != nil {
+		recordFailure(db, push, err, apnsID)
+		return
+	}
+
+	if err := database.MarkPushSent(db, push.ID); err != nil {
+		log.Printf("Error marking push %d sent: %v", push.ID, err)
+	}
+	recordDelivery(db, push, database.DeliverySent, apnsID, "")
+}
+
+// failureStatus decides what happens to a failed push: the device is removed, the email
+// bounced, it is tried again later or it is given up on
+func failureStatus(push database.Push, pushErr error) string {
+	switch {
+	case invalidToken(pushErr):
+		return database.DeliveryInvalid
+	case bounced(pushErr):
+		return database.DeliveryBounced
+	case retryable(pushErr) && push.Attempts < maxPushAttempts:
+		return database.DeliveryRetrying
+	default:
+		return database.DeliveryFailed
+	}
+}
+
+// recordFailure retries the push with backoff, or gives up on it. Devices with dead
+// tokens are removed so they aren't pushed to again.
+func recordFailure(db *sql.DB, push database.Push, pushErr error, apnsID string) {
+	var err error
+	status := failureStatus(push, pushErr)
+	switch status {
+	case database.DeliveryInvalid:
+		log.Printf("Removing device %s, its token is no longer valid: %v", database.MaskToken(push.Token), pushErr)
+		err = database.FailPush(db, push.ID, pushErr.Error())
+		if removeErr := database.RemoveDeadDevice(db, push.Token); removeErr != nil {
+			log.Printf("Error removing device %s: %v", database.MaskToken(push.Token), removeErr)
+		}
+	case database.DeliveryBounced:
+		// The address stays on the user, there is no device to remove
+		err = database.FailPush(db, push.ID, pushErr.Error())
+	case database.DeliveryRetrying:
+		err = database.RetryPush(db, push.ID, backoff(push.Attempts), pushErr.Error())
+	default:
+		log.Printf("Giving up on push %d for notification %s: %v", push.ID, push.NotificationID, pushErr)
+		err = database.FailPush(db, push.ID, pushErr.Error())
+	}
+
+	if err != nil {
+		log.Printf("Error recording failed push %d: %v", push.ID, err)
+	}
+	recordDelivery(db, push, status, apnsID, pushErr.Error())
+}
+
+func recordDelivery(db *sql.DB, push database.Push, status string, apnsID string, reason string) {
+	if push.NotificationID == "" {
+		// Reminders and silent pushes aren't for a notification, so there is nothing to report them under
+		return
+	}
+
+	err := database.RecordDelivery(db, database.Delivery{
+		NotificationID: push.NotificationID,
+		PushID:         push.ID,
+		UserID:         push.UserID,
+		Token:          push.Token,
+		Channel:        channelOf(push),
+		Status:         status,
+		ApnsID:         apnsID,
+		Reason:         reason,
+	})
+	if err != nil {
+		log.Printf("Error recording delivery of push %d: %v", push.ID, err)
+	}
+}
+
+// channelOf is which channel a queued push goes out through
+func channelOf(push database.Push) string {
+	if push.DeviceType == database.DeviceEmail {
+		return database.ChannelEmail
+	}
+	return database.ChannelPush
+}
+
+// backoff is how long to wait before the next attempt, doubling each time
+func backoff(attempts int) time.Duration {
+	delay := time.Duration(float64(pushBackoffBase) * math.Pow(2, float64(attempts-1)))
+	if delay > pushBackoffMax {
+		return pushBackoffMax
+	}
+	return delay
+}
@@ -0,0 +1,110 @@
+package notifications
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"prorickey/nctsa/database"
+)
+
+// pushWith sends a push to the token through the fake and returns the error it failed with
+func pushWith(t *testing.T, fake *FakeProvider, token string) error {
+	t.Helper()
+
+	_, err := fake.Push(context.Background(), Device{Token: token}, Message{Title: "Opening ceremony"})
+	if err == nil {
+		t.Fatalf("push to %s went out, expected it to fail", token)
+	}
+	return err
+}
+
+func TestFakeProviderSends(t *testing.T) {
+	fake := NewFakeProvider()
+	fake.Fail("dead-token", "gone", false, true)
+
+	id, err := fake.Push(context.Background(), Device{Token: "live-token"}, Message{Title: "Opening ceremony"})
+	if err != nil {
+		t.Fatalf("push to a working token failed: %v", err)
+	}
+	if id == "" {
+		t.Error("push returned no id")
+	}
+	if len(fake.Sent) != 1 || fake.Sent[0].Device.Token != "live-token" {
+		t.Errorf("sent = %+v, want one push to live-token", fake.Sent)
+	}
+}
+
+func TestFailureStatus(t *testing.T) {
+	fake := NewFakeProvider()
+	fake.Fail("busy-token", "503 service unavailable", true, false)
+	fake.Fail("dead-token", "410 unregistered", false, true)
+	fake.Fail("dead-retry-token", "410 unregistered", true, true)
+	fake.Fail("bad-token", "400 bad request", false, false)
+	fake.Bounce("nobody@example.com", "550 no such user")
+
+	tests := []struct {
+		name     string
+		token    string
+		attempts int
+		want     string
+	}{
+		{"retryable error is retried", "busy-token", 1, database.DeliveryRetrying},
+		{"retryable error is retried until the last attempt", "busy-token", maxPushAttempts - 1, database.DeliveryRetrying},
+		{"retryable error gives up after the last attempt", "busy-token", maxPushAttempts, database.DeliveryFailed},
+		{"invalid token removes the device", "dead-token", 1, database.DeliveryInvalid},
+		{"invalid token isn't retried even if retryable", "dead-retry-token", 1, database.DeliveryInvalid},
+		{"permanent error gives up straight away", "bad-token", 1, database.DeliveryFailed},
+		{"bounced email isn't retried", "nobody@example.com", 1, database.DeliveryBounced},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := pushWith(t, fake, test.token)
+			push := database.Push{ID: 1, Token: test.token, Attempts: test.attempts}
+
+			if got := failureStatus(push, err); got != test.want {
+				t.Errorf("failureStatus after %d attempts = %q, want %q", test.attempts, got, test.want)
+			}
+		})
+	}
+
+	if len(fake.Sent) != 0 {
+		t.Errorf("failed pushes were recorded as sent: %+v", fake.Sent)
+	}
+}
+
+func TestFailureStatusOtherErrors(t *testing.T) {
+	// Anything that isn't a pushError, like a dropped connection, is worth another try
+	push := database.Push{ID: 1, Token: "token", Attempts: 1}
+	if got := failureStatus(push, errors.New("connection reset")); got != database.DeliveryRetrying {
+		t.Errorf("failureStatus = %q, want %q", got, database.DeliveryRetrying)
+	}
+
+	_, err := providerFor("pager")
+	if err == nil {
+		t.Fatal("expected an error for a device type with no provider")
+	}
+	if got := failureStatus(push, err); got != database.DeliveryFailed {
+		t.Errorf("failureStatus for a missing provider = %q, want %q", got, database.DeliveryFailed)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, pushBackoffBase},
+		{2, 2 * pushBackoffBase},
+		{3, 4 * pushBackoffBase},
+		{20, pushBackoffMax},
+	}
+
+	for _, test := range tests {
+		if got := backoff(test.attempts); got != test.want {
+			t.Errorf("backoff(%d) = %v, want %v", test.attempts, got, test.want)
+		}
+	}
+}
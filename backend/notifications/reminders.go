@@ -0,0 +1,55 @@
+package notifications
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"prorickey/nctsa/database"
+)
+
+// SendReminder queues a push to each of the user's devices about an item that is starting soon.
+// Reminders are only pushed, they don't show up in the notifications list. They wait for no
+// one, so a reminder that comes up during the user's quiet hours isn't sent.
+func SendReminder(db *sql.DB, reminder database.Reminder) error {
+	recipients, err := database.GetPushDevices(db, []database.Target{{Type: database.TargetUser, ID: reminder.UserID}}, "reminder")
+	if err != nil {
+		return err
+	}
+
+	body := fmt.Sprintf("%s starts at %s", reminder.Title, reminder.Date.Format("3:04 PM"))
+	if reminder.Location != "" {
+		body += " in " + reminder.Location
+	}
+
+	link := &database.Link{Type: database.LinkAgenda, ID: reminder.AgendaID}
+	if reminder.EventID != "" {
+		link = &database.Link{Type: database.LinkEvent, ID: reminder.EventID}
+	}
+
+	msg, err := json.Marshal(Message{
+		Title: "Starting soon: " + reminder.Title,
+		Body:  body,
+		Data: map[string]string{
+			"type":     "reminder",
+			"agendaId": reminder.AgendaID,
+		},
+		Link: link,
+	})
+	if err != nil {
+		return err
+	}
+
+	pushes := make([]database.Push, 0, len(recipients))
+	for _, recipient := range recipients {
+		pushes = append(pushes, database.Push{
+			UserID:      recipient.UserID,
+			Token:       recipient.Token,
+			DeviceType:  recipient.DeviceType,
+			Environment: recipient.Environment,
+			Message:     msg,
+		})
+	}
+
+	return queuePushes(db, pushes)
+}
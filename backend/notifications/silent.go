@@ -0,0 +1,58 @@
+package notifications
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"prorickey/nctsa/database"
+)
+
+// SendSilent queues a background push with the data to each of the devices. Nothing is
+// shown, the app wakes up and acts on the data.
+func SendSilent(db *sql.DB, recipients []database.DeviceRecipient, data map[string]string) error {
+	msg, err := json.Marshal(Message{Data: data, Silent: true})
+	if err != nil {
+		return err
+	}
+
+	pushes := make([]database.Push, 0, len(recipients))
+	for _, recipient := range recipients {
+		pushes = append(pushes, database.Push{
+			UserID:      recipient.UserID,
+			Token:       recipient.Token,
+			DeviceType:  recipient.DeviceType,
+			Environment: recipient.Environment,
+			Message:     msg,
+		})
+	}
+
+	return queuePushes(db, pushes)
+}
+
+// SilentDevices leaves out the devices that can't take a silent push. A web push always
+// has to show something, so browsers would get a generic notification for every one and
+// can end up revoking the subscription.
+func SilentDevices(devices []database.DeviceRecipient) []database.DeviceRecipient {
+	silent := make([]database.DeviceRecipient, 0, len(devices))
+	for _, device := range devices {
+		if device.DeviceType != database.DeviceWeb {
+			silent = append(silent, device)
+		}
+	}
+
+	return silent
+}
+
+// SendRetraction tells every app the notification could have reached to delete its copy.
+// Mutes and quiet hours don't matter here, the app has to drop it either way.
+func SendRetraction(db *sql.DB, noti database.Notification) error {
+	recipients, err := database.GetAudienceDevices(db, noti.Targets)
+	if err != nil {
+		return err
+	}
+
+	return SendSilent(db, SilentDevices(recipients), map[string]string{
+		"type":           "retract",
+		"notificationID": noti.ID,
+	})
+}
@@ -0,0 +1,218 @@
+package notifications
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+
+	"prorickey/nctsa/database"
+)
+
+/*
+Notification titles and descriptions can contain placeholders that are filled in
+when the notification is sent and when it is shown in the app:
+
+	{{event.name}} {{event.location}} {{event.date}} {{event.startTime}} {{event.endTime}}
+	{{user.shortName}} {{user.fullName}} {{school.name}}
+
+The event ones come from the event the notification is about (its eventId), the
+user and school ones are rendered separately for every recipient.
+*/
+
+var placeholderPattern = regexp.MustCompile(`{{\s*([a-zA-Z]+)\.([a-zA-Z]+)\s*}}`)
+
+var placeholders = map[string]bool{
+	"event.name":      true,
+	"event.location":  true,
+	"event.date":      true,
+	"event.startTime": true,
+	"event.endTime":   true,
+	"user.shortName":  true,
+	"user.fullName":   true,
+	"school.name":     true,
+}
+
+// CheckPlaceholders makes sure every placeholder in the text is one we know how to fill in
+func CheckPlaceholders(text string) error {
+	for _, match := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+		key := match[1] + "." + match[2]
+		if !placeholders[key] {
+			return fmt.Errorf("unknown placeholder {{%s}}", key)
+		}
+	}
+
+	return nil
+}
+
+// IsPersonalized reports whether the text has to be rendered for each recipient
+func IsPersonalized(text string) bool {
+	for _, match := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+		if match[1] == "user" || match[1] == "school" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Render fills the placeholders in the text, unknown or missing values render as nothing
+func Render(text string, vars map[string]string) string {
+	if !strings.Contains(text, "{{") {
+		return text
+	}
+
+	return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		match := placeholderPattern.FindStringSubmatch(placeholder)
+		return vars[match[1]+"."+match[2]]
+	})
+}
+
+// Renderer renders a notification for each of its recipients. The event is loaded
+// once up front and users are loaded as they are needed.
+type Renderer struct {
+	db           *sql.DB
+	noti         database.Notification
+	vars         map[string]string
+	personalized bool
+	users        map[string]map[string]string
+}
+
+func NewRenderer(db *sql.DB, noti database.Notification) *Renderer {
+	r := &Renderer{
+		db:           db,
+		noti:         noti,
+		vars:         map[string]string{},
+		personalized: IsPersonalized(noti.Title) || IsPersonalized(noti.Description),
+		users:        map[string]map[string]string{},
+	}
+
+	if noti.EventID != "" {
+		event, err := database.GetEvent(db, noti.EventID)
+		if err != nil {
+			log.Printf("Error loading event %s for notification %s: %v", noti.EventID, noti.ID, err)
+		} else {
+			addEventVars(r.vars, event)
+		}
+	}
+
+	return r
+}
+
+func addEventVars(vars map[string]string, event database.Event) {
+	vars["event.name"] = event.Name
+	vars["event.location"] = event.Location
+	vars["event.date"] = event.StartTime.Format("Monday, January 2")
+	vars["event.startTime"] = event.StartTime.Format("3:04 PM")
+	vars["event.endTime"] = event.EndTime.Format("3:04 PM")
+}
+
+func addUserVars(vars map[string]string, user database.TemplateUser) {
+	vars["user.shortName"] = user.ShortName
+	vars["user.fullName"] = user.FullName
+	vars["school.name"] = user.SchoolName
+}
+
+// For returns the title and description as the user should see them
+func (r *Renderer) For(userID string) (string, string) {
+	vars := r.vars
+	if r.personalized && userID != "" {
+		vars = r.userVars(userID)
+	}
+
+	return Render(r.noti.Title, vars), Render(r.noti.Description, vars)
+}
+
+func (r *Renderer) userVars(userID string) map[string]string {
+	if vars, ok := r.users[userID]; ok {
+		return vars
+	}
+
+	vars := make(map[string]string, len(r.vars)+3)
+	for k, v := range r.vars {
+		vars[k] = v
+	}
+
+	user, err := database.GetTemplateUser(r.db, userID)
+	if err != nil {
+		log.Printf("Error loading user %s for notification %s: %v", userID, r.noti.ID, err)
+	} else {
+		addUserVars(vars, user)
+	}
+
+	r.users[userID] = vars
+	return vars
+}
+
+// FeedRenderer renders the notifications in one user's feed, where it runs on every
+// request. Events come from the cache and the user is only loaded once, the first time
+// a notification needs them. An empty user id renders the user placeholders as nothing.
+type FeedRenderer struct {
+	db     *sql.DB
+	userID string
+	events map[string]database.Event
+	user   map[string]string
+}
+
+func NewFeedRenderer(db *sql.DB, userID string) *FeedRenderer {
+	return &FeedRenderer{db: db, userID: userID}
+}
+
+// Render returns the notification with its title and description filled in for the user
+func (f *FeedRenderer) Render(noti database.Notification) database.Notification {
+	if !strings.Contains(noti.Title, "{{") && !strings.Contains(noti.Description, "{{") {
+		return noti
+	}
+
+	vars := map[string]string{}
+	if noti.EventID != "" {
+		if event, ok := f.event(noti.EventID); ok {
+			addEventVars(vars, event)
+		}
+	}
+	if IsPersonalized(noti.Title) || IsPersonalized(noti.Description) {
+		for k, v := range f.userVars() {
+			vars[k] = v
+		}
+	}
+
+	noti.Title, noti.Description = Render(noti.Title, vars), Render(noti.Description, vars)
+	return noti
+}
+
+func (f *FeedRenderer) event(id string) (database.Event, bool) {
+	if f.events == nil {
+		f.events = map[string]database.Event{}
+		events, err := database.GetEventCache()
+		if err != nil {
+			log.Printf("Error loading events to render notifications: %v", err)
+		}
+		for _, event := range events {
+			f.events[event.ID] = event
+		}
+	}
+
+	event, ok := f.events[id]
+	return event, ok
+}
+
+func (f *FeedRenderer) userVars() map[string]string {
+	if f.user != nil {
+		return f.user
+	}
+
+	f.user = map[string]string{}
+	if f.userID == "" {
+		return f.user
+	}
+
+	user, err := database.GetTemplateUser(f.db, f.userID)
+	if err != nil {
+		log.Printf("Error loading user %s to render notifications: %v", f.userID, err)
+	} else {
+		addUserVars(f.user, user)
+	}
+
+	return f.user
+}
@@ -0,0 +1,115 @@
+package notifications
+
+import (
+	"testing"
+	"time"
+
+	"prorickey/nctsa/database"
+)
+
+func TestCheckPlaceholders(t *testing.T) {
+	valid := []string{
+		"",
+		"No placeholders here",
+		"{{event.name}} starts at {{event.startTime}} in {{event.location}}",
+		"{{ event.date }} until {{event.endTime}}",
+		"Hi {{user.shortName}} ({{user.fullName}}) from {{school.name}}",
+		"Curly { braces } on their own are fine",
+	}
+	for _, text := range valid {
+		if err := CheckPlaceholders(text); err != nil {
+			t.Errorf("CheckPlaceholders(%q) = %v, want no error", text, err)
+		}
+	}
+
+	invalid := []string{
+		"{{event.room}}",
+		"Hi {{user.email}}",
+		"{{user.shortName}} and {{school.city}}",
+		"{{Event.name}}",
+	}
+	for _, text := range invalid {
+		if err := CheckPlaceholders(text); err == nil {
+			t.Errorf("CheckPlaceholders(%q) should have failed", text)
+		}
+	}
+}
+
+func TestIsPersonalized(t *testing.T) {
+	tests := map[string]bool{
+		"Plain text": false,
+		"{{event.name}} moved to {{event.location}}": false,
+		"Good luck {{user.shortName}}!":              true,
+		"{{ user.fullName }}":                        true,
+		"Go {{school.name}}":                         true,
+		"{{event.name}} for {{school.name}}":         true,
+	}
+
+	for text, want := range tests {
+		if got := IsPersonalized(text); got != want {
+			t.Errorf("IsPersonalized(%q) = %v, want %v", text, got, want)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	vars := map[string]string{
+		"event.name":     "Robotics",
+		"event.location": "Hall B",
+		"user.shortName": "Sam",
+	}
+
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"No placeholders", "No placeholders"},
+		{"{{event.name}} is in {{event.location}}", "Robotics is in Hall B"},
+		{"Good luck {{ user.shortName }}!", "Good luck Sam!"},
+		{"{{event.name}} {{event.name}}", "Robotics Robotics"},
+		{"Missing: [{{school.name}}]", "Missing: []"},
+		{"Unknown: [{{event.room}}]", "Unknown: []"},
+		{"Not a placeholder: {{eventname}}", "Not a placeholder: {{eventname}}"},
+	}
+
+	for _, test := range tests {
+		if got := Render(test.text, vars); got != test.want {
+			t.Errorf("Render(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestRenderEventVars(t *testing.T) {
+	vars := map[string]string{}
+	addEventVars(vars, database.Event{
+		Name:      "Robotics",
+		Location:  "Hall B",
+		StartTime: time.Date(2025, 3, 31, 14, 5, 0, 0, time.UTC),
+		EndTime:   time.Date(2025, 3, 31, 16, 0, 0, 0, time.UTC),
+	})
+	addUserVars(vars, database.TemplateUser{ShortName: "Sam", FullName: "Sam Lee", SchoolName: "Central High"})
+
+	got := Render("{{event.name}}, {{event.date}} {{event.startTime}}-{{event.endTime}} in {{event.location}} for {{user.fullName}} of {{school.name}}", vars)
+	want := "Robotics, Monday, March 31 2:05 PM-4:00 PM in Hall B for Sam Lee of Central High"
+	if got != want {
+		t.Errorf("Render = %q, want %q", got, want)
+	}
+}
+
+func TestFeedRendererWithoutUser(t *testing.T) {
+	renderer := NewFeedRenderer(nil, "")
+
+	plain := database.Notification{ID: "1", Title: "Lunch", Description: "Lunch is served"}
+	if got := renderer.Render(plain); got.Title != plain.Title || got.Description != plain.Description {
+		t.Errorf("plain notification rendered as %q / %q", got.Title, got.Description)
+	}
+
+	personal := database.Notification{ID: "2", Title: "Good luck {{user.shortName}}", Description: "Go {{school.name}}!"}
+	got := renderer.Render(personal)
+	if got.Title != "Good luck " || got.Description != "Go !" {
+		t.Errorf("personalized notification without a user rendered as %q / %q", got.Title, got.Description)
+	}
+	if personal.Title != "Good luck {{user.shortName}}" {
+		t.Error("rendering changed the original notification")
+	}
+}
@@ -0,0 +1,164 @@
+package notifications
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+
+	"prorickey/nctsa/database"
+
+	webpush "github.com/SherClockHolmes/webpush-go"
+)
+
+/*
+Browsers subscribe to web push with the VAPID public key and register the
+subscription as a web device, its endpoint is the token. The payload is the
+Message as json, encrypted for the subscription, and the site's service worker
+shows it. The keys come from VAPID_PUBLIC_KEY and VAPID_PRIVATE_KEY, or are
+made once and kept in the vapid_keys table.
+*/
+
+const (
+	defaultVAPIDSubject = "mailto:noreply@northcarolinatsa.org"
+	webPushTTL          = 24 * 60 * 60 // seconds a push service keeps trying to reach an offline browser
+)
+
+// webPushHosts are the push services browsers hand out endpoints on. Pushes are only
+// sent to these, anything else could point the workers at hosts inside the cluster.
+var webPushHosts = []string{
+	"fcm.googleapis.com",        // Chrome and other Chromium browsers
+	"push.services.mozilla.com", // Firefox
+	"push.apple.com",            // Safari
+	"notify.windows.com",        // Edge on Windows
+}
+
+// ValidWebPushEndpoint reports whether the endpoint is https on one of the known push services
+func ValidWebPushEndpoint(endpoint string) bool {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "https" || u.User != nil || (u.Port() != "" && u.Port() != "443") {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	for _, allowed := range webPushHosts {
+		if host == allowed || strings.HasSuffix(host, "."+allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	vapidMu   sync.Mutex
+	vapidKeys *database.VAPIDKeys
+)
+
+// VAPIDKeys returns the key pair web pushes are signed with, making it the first time
+func VAPIDKeys(db *sql.DB) (database.VAPIDKeys, error) {
+	vapidMu.Lock()
+	defer vapidMu.Unlock()
+
+	if vapidKeys != nil {
+		return *vapidKeys, nil
+	}
+
+	if public, private := os.Getenv("VAPID_PUBLIC_KEY"), os.Getenv("VAPID_PRIVATE_KEY"); public != "" && private != "" {
+		vapidKeys = &database.VAPIDKeys{Public: public, Private: private}
+		return *vapidKeys, nil
+	}
+
+	private, public, err := webpush.GenerateVAPIDKeys()
+	if err != nil {
+		return database.VAPIDKeys{}, err
+	}
+	keys, err := database.EnsureVAPIDKeys(db, database.VAPIDKeys{Public: public, Private: private})
+	if err != nil {
+		return keys, err
+	}
+
+	vapidKeys = &keys
+	return keys, nil
+}
+
+// vapidSubject is who push services can contact about our pushes, set with VAPID_SUBJECT
+func vapidSubject() string {
+	if subject := os.Getenv("VAPID_SUBJECT"); subject != "" {
+		return subject
+	}
+	return defaultVAPIDSubject
+}
+
+// webPushProvider sends pushes to browsers. It needs the database for the VAPID keys and
+// the subscription's encryption keys, so it is set up by StartWorkers.
+type webPushProvider struct {
+	db *sql.DB
+}
+
+func (p *webPushProvider) Push(ctx context.Context, device Device, msg Message) (string, error) {
+	if !ValidWebPushEndpoint(device.Token) {
+		// Registered before endpoints were checked, drop it rather than calling it
+		return "", &pushError{reason: "endpoint is not a known push service", invalidToken: true}
+	}
+
+	keys, err := VAPIDKeys(p.db)
+	if err != nil {
+		return "", &pushError{reason: "vapid keys: " + err.Error(), retry: true}
+	}
+
+	p256dh, auth, err := database.GetWebSubscriptionKeys(p.db, device.Token)
+	if err == sql.ErrNoRows {
+		return "", &pushError{reason: "subscription no longer registered", invalidToken: true}
+	}
+	if err != nil {
+		return "", &pushError{reason: err.Error(), retry: true}
+	}
+
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return "", &pushError{reason: "bad message: " + err.Error()}
+	}
+
+	urgency := webpush.UrgencyNormal
+	if msg.Emergency {
+		urgency = webpush.UrgencyHigh
+	} else if msg.Silent {
+		urgency = webpush.UrgencyLow
+	}
+
+	res, err := webpush.SendNotificationWithContext(ctx, payload, &webpush.Subscription{
+		Endpoint: device.Token,
+		Keys:     webpush.Keys{P256dh: p256dh, Auth: auth},
+	}, &webpush.Options{
+		Subscriber:      vapidSubject(),
+		VAPIDPublicKey:  keys.Public,
+		VAPIDPrivateKey: keys.Private,
+		TTL:             webPushTTL,
+		Urgency:         urgency,
+	})
+	if err != nil {
+		// Couldn't reach the push service, or the payload couldn't be encrypted
+		return "", &pushError{reason: err.Error(), retry: true}
+	}
+	defer res.Body.Close()
+
+	// The push service's id for the message is the path of its Location
+	id := res.Header.Get("Location")
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return id, nil
+	}
+
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 256))
+	return id, &pushError{
+		reason:       fmt.Sprintf("web push %d: %s", res.StatusCode, body),
+		status:       res.StatusCode,
+		retry:        res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= http.StatusInternalServerError,
+		invalidToken: res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusGone,
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"log"
 	"net/http"
 	"prorickey/nctsa/database"
+	"prorickey/nctsa/scheduler"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -33,6 +34,11 @@ func PostAgenda(context *gin.Context) {
 		return
 	}
 
+	if err := checkPublishAt(agenda.PublishAt, &agenda.Published); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	db, exists := context.Get("db")
 	if !exists {
 		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
@@ -43,9 +49,9 @@ func PostAgenda(context *gin.Context) {
 
 	var uuid string
 	var createdAt time.Time
-	err = conn.QueryRow(`INSERT INTO "agenda" (title, description, date, endTime, location, published, icon) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id, createdAt`,
+	err = conn.QueryRow(`INSERT INTO "agenda" (title, description, date, endTime, location, published, icon, publishAt) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id, createdAt`,
 		agenda.Title, agenda.Description, agenda.Date, agenda.EndTime,
-		agenda.Location, agenda.Published, agenda.Icon).Scan(&uuid, &createdAt)
+		agenda.Location, agenda.Published, agenda.Icon, agenda.PublishAt).Scan(&uuid, &createdAt)
 		
 	if err != nil {
 		log.Printf("Error inserting agenda: %v", err)
@@ -57,6 +63,9 @@ func PostAgenda(context *gin.Context) {
 	agenda.CreatedAt = createdAt
 
 	database.AddAgendaItemToCache(agenda)
+	if !audit(context, "", "agenda", agenda.ID, nil, agenda) {
+		return
+	}
 
 	context.JSON(http.StatusOK, gin.H{"message": "Agenda posted", "agenda": agenda})
 }
@@ -70,6 +79,11 @@ func UpdateAgenda(context *gin.Context) {
 		return
 	}
 
+	if err := checkPublishAt(agenda.PublishAt, &agenda.Published); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	db, exists := context.Get("db")
 	if !exists {
 		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
@@ -78,21 +92,40 @@ func UpdateAgenda(context *gin.Context) {
 
 	conn := db.(*sql.DB)
 
-	_, err := conn.Exec(`UPDATE "agenda" SET title=$1, description=$2, date=$3, endTime=$4, location=$5, icon=$6, published=$7 WHERE id=$8`,
+	before, err := database.GetAgendaItem(conn, id)
+	if err == sql.ErrNoRows {
+		context.JSON(http.StatusNotFound, gin.H{"error": "Agenda item not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading agenda item %s: %v", id, err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update agenda item"})
+		return
+	}
+
+	_, err = conn.Exec(`UPDATE "agenda" SET title=$1, description=$2, date=$3, endTime=$4, location=$5, icon=$6, published=$7, publishAt=$8 WHERE id=$9`,
 		agenda.Title, agenda.Description, agenda.Date, agenda.EndTime,
-		agenda.Location, agenda.Icon, agenda.Published, id)
+		agenda.Location, agenda.Icon, agenda.Published, agenda.PublishAt, id)
 
 	if err != nil {
 		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update agenda item"})
 		return
 	}
 
+	// Make sure to set the ID before updating the cache
+	agenda.ID = id
+	agenda.EventId = before.EventId
+	agenda.CreatedAt = before.CreatedAt
 	database.UpdateAgendaItemInCache(agenda)
+	if !audit(context, "", "agenda", id, before, agenda) {
+		return
+	}
+	scheduler.AgendaItemChanged(conn, before, agenda)
 
 	context.JSON(http.StatusOK, gin.H{"message": "Agenda updated", "agenda": agenda})
 }
 
-// DeleteAgenda deletes an agenda item.
+// DeleteAgenda moves an agenda item to the trash.
 func DeleteAgenda(context *gin.Context) {
 	id := context.Param("id")
 
@@ -104,7 +137,18 @@ func DeleteAgenda(context *gin.Context) {
 
 	conn := db.(*sql.DB)
 
-	_, err := conn.Exec(`DELETE FROM "agenda" WHERE id=$1`, id)
+	before, err := database.GetAgendaItem(conn, id)
+	if err == sql.ErrNoRows {
+		context.JSON(http.StatusNotFound, gin.H{"error": "Agenda item not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading agenda item %s: %v", id, err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete agenda item"})
+		return
+	}
+
+	_, err = database.SoftDeleteAgendaItem(conn, id)
 	if err != nil {
 		log.Printf("Error deleting agenda: %v", err)
 		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete agenda item"})
@@ -112,6 +156,9 @@ func DeleteAgenda(context *gin.Context) {
 	}
 
 	database.DeleteAgendaItemFromCache(id)
+	if !audit(context, "", "agenda", id, before, nil) {
+		return
+	}
 
 	context.JSON(http.StatusOK, gin.H{"message": "Agenda deleted"})
 }
\ No newline at end of file
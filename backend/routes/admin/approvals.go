@@ -0,0 +1,279 @@
+package admin
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+	"prorickey/nctsa/database"
+	"prorickey/nctsa/scheduler"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const defaultApprovalDeviceThreshold = 200
+
+// approvalDeviceThreshold is how many devices a targeted notification can reach before
+// it needs a second admin's approval, set with APPROVAL_DEVICE_THRESHOLD
+func approvalDeviceThreshold() int {
+	if threshold, err := strconv.Atoi(os.Getenv("APPROVAL_DEVICE_THRESHOLD")); err == nil && threshold > 0 {
+		return threshold
+	}
+
+	return defaultApprovalDeviceThreshold
+}
+
+// needsApproval reports whether a notification reaches enough people that a second
+// admin has to approve it. Notifications to everyone always do.
+func needsApproval(conn *sql.DB, notification database.Notification) (bool, error) {
+	if database.TargetsAll(notification.Targets) {
+		return true, nil
+	}
+
+	size, err := database.CountAudience(conn, notification.Targets)
+	if err != nil {
+		return false, err
+	}
+
+	return size.Devices >= approvalDeviceThreshold(), nil
+}
+
+// publishingStatus works out where a notification that is being saved ends up in the
+// approval workflow. If it needs approval it is held back as pending instead of being
+// published, otherwise it is sent now (sent) or when its publishAt comes (approved).
+// Emergencies are always sent straight away, validNotification has already checked the key
+// is allowed to send them.
+func publishingStatus(conn *sql.DB, notification *database.Notification) (string, error) {
+	if !notification.Published && notification.PublishAt == nil {
+		return database.StatusDraft, nil
+	}
+	if notification.Type == database.TypeEmergency {
+		// Emergencies can't wait for a second admin, only emergency senders get this far
+		return database.StatusSent, nil
+	}
+
+	approval, err := needsApproval(conn, *notification)
+	if err != nil {
+		return "", err
+	}
+
+	if approval {
+		notification.Published = false
+		return database.StatusPending, nil
+	}
+	if notification.PublishAt != nil {
+		return database.StatusApproved, nil
+	}
+
+	return database.StatusSent, nil
+}
+
+// recordReview adds a step to the approval history on behalf of whoever is making the request
+func recordReview(context *gin.Context, conn *sql.DB, id string, action string, comment string) {
+	keyID, name := actor(context)
+	err := database.RecordReview(conn, database.NotificationReview{
+		NotificationID: id,
+		ActorKeyID:     keyID,
+		Actor:          name,
+		Action:         action,
+		Comment:        comment,
+	})
+	if err != nil {
+		log.Printf("Error recording %s review of notification %s: %v", action, id, err)
+	}
+}
+
+type reviewRequest struct {
+	Comment string `json:"comment"`
+}
+
+// PostApproveNotification approves a pending notification, publishing and sending it
+// unless it is scheduled for later. It has to be approved by an admin, and a different one
+// than the one that created or last edited it.
+func PostApproveNotification(context *gin.Context) {
+	id := context.Param("id")
+
+	var request reviewRequest
+	if context.Request.ContentLength > 0 {
+		if err := context.BindJSON(&request); err != nil {
+			context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+	}
+
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+
+	conn := db.(*sql.DB)
+
+	if context.GetString("admin_name") == "" {
+		// Backend and service keys don't count as a second admin
+		context.JSON(http.StatusForbidden, gin.H{"error": database.ErrNotAdmin.Error()})
+		return
+	}
+
+	before, err := database.GetNotification(conn, id)
+	if err == sql.ErrNoRows {
+		context.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading notification %s: %v", id, err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve notification"})
+		return
+	}
+
+	keyID, _ := actor(context)
+	notification, err := database.ApproveNotification(conn, id, keyID)
+	if errors.Is(err, database.ErrNotPending) {
+		context.JSON(http.StatusConflict, gin.H{"error": "Notification is not pending approval"})
+		return
+	}
+	if errors.Is(err, database.ErrSelfApprove) || errors.Is(err, database.ErrNotAdmin) {
+		context.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Error approving notification %s: %v", id, err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve notification"})
+		return
+	}
+
+	recordReview(context, conn, id, "approve", request.Comment)
+	database.UpdateNotificationInCache(notification)
+	if !audit(context, "approve", "notification", id, before, notification) {
+		return
+	}
+
+	if notification.Published {
+		scheduler.QueueNotification(conn, notification)
+		if !finishCorrection(context, conn, notification) {
+			return
+		}
+	}
+
+	context.JSON(http.StatusOK, gin.H{"message": "Notification approved", "notification": notification})
+}
+
+// PostRejectNotification turns down a pending notification. The same as approving, only
+// an admin other than the one that last edited it can.
+func PostRejectNotification(context *gin.Context) {
+	id := context.Param("id")
+
+	var request reviewRequest
+	if context.Request.ContentLength > 0 {
+		if err := context.BindJSON(&request); err != nil {
+			context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+			return
+		}
+	}
+
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+
+	conn := db.(*sql.DB)
+
+	if context.GetString("admin_name") == "" {
+		// Only admins review, same as approving
+		context.JSON(http.StatusForbidden, gin.H{"error": database.ErrNotAdmin.Error()})
+		return
+	}
+
+	before, err := database.GetNotification(conn, id)
+	if err == sql.ErrNoRows {
+		context.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading notification %s: %v", id, err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reject notification"})
+		return
+	}
+
+	keyID, _ := actor(context)
+	notification, err := database.RejectNotification(conn, id, keyID)
+	if errors.Is(err, database.ErrNotPending) {
+		context.JSON(http.StatusConflict, gin.H{"error": "Notification is not pending approval"})
+		return
+	}
+	if errors.Is(err, database.ErrSelfApprove) || errors.Is(err, database.ErrNotAdmin) {
+		context.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		log.Printf("Error rejecting notification %s: %v", id, err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reject notification"})
+		return
+	}
+
+	recordReview(context, conn, id, "reject", request.Comment)
+	database.UpdateNotificationInCache(notification)
+	if !audit(context, "reject", "notification", id, before, notification) {
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"message": "Notification rejected"})
+}
+
+// PostNotificationComment adds a comment to a notification's review history
+func PostNotificationComment(context *gin.Context) {
+	id := context.Param("id")
+
+	var request reviewRequest
+	if err := context.BindJSON(&request); err != nil || request.Comment == "" {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "A comment is required"})
+		return
+	}
+
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+
+	conn := db.(*sql.DB)
+
+	if _, err := database.GetNotification(conn, id); err == sql.ErrNoRows {
+		context.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	} else if err != nil {
+		log.Printf("Error loading notification %s: %v", id, err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add comment"})
+		return
+	}
+
+	recordReview(context, conn, id, "comment", request.Comment)
+	if !audit(context, "comment", "notification", id, nil, gin.H{"comment": request.Comment}) {
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"message": "Comment added"})
+}
+
+// GetNotificationReviews returns the approval history of a notification
+func GetNotificationReviews(context *gin.Context) {
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+
+	conn := db.(*sql.DB)
+
+	reviews, err := database.ListReviews(conn, context.Param("id"))
+	if err != nil {
+		log.Printf("Error listing notification reviews: %v", err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Server failed to retrieve reviews"})
+		return
+	}
+
+	context.JSON(http.StatusOK, reviews)
+}
@@ -0,0 +1,112 @@
+package admin
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"prorickey/nctsa/database"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// audit records a change the current request made in the audit log, requests that make
+// more than one change (like sending a correction) record each of them. An empty action
+// is derived from the request method (create, update or delete). Nothing in /admin goes
+// unaudited, so if the entry can't be written the request fails with a 500 and false is
+// returned, the handler should stop there.
+func audit(context *gin.Context, action string, entityType string, entityID string, before any, after any) bool {
+	if action == "" {
+		action = actionForMethod(context.Request.Method)
+	}
+
+	entry := database.AuditEntry{
+		Action:     action,
+		EntityType: entityType,
+		EntityID:   entityID,
+		IP:         context.ClientIP(),
+	}
+	entry.ActorKeyID, entry.Actor = actor(context)
+
+	conn := context.MustGet("db").(*sql.DB)
+	if err := database.RecordAudit(conn, entry, before, after); err != nil {
+		log.Printf("Error recording audit entry for %s %s: %v", context.Request.Method, context.FullPath(), err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record the change in the audit log"})
+		return false
+	}
+
+	return true
+}
+
+// actor returns the api key id and name of whoever is making the request. The name is
+// the admin's if the key belongs to one, otherwise the key's purpose.
+func actor(context *gin.Context) (string, string) {
+	var keyID, name string
+	if val, ok := context.Get("api_key"); ok {
+		key := val.(database.ApiKey)
+		keyID = key.ID
+		name = key.Purpose
+	}
+	if adminName := context.GetString("admin_name"); adminName != "" {
+		name = adminName
+	}
+
+	return keyID, name
+}
+
+func actionForMethod(method string) string {
+	switch method {
+	case http.MethodPost:
+		return "create"
+	case http.MethodPut, http.MethodPatch:
+		return "update"
+	case http.MethodDelete:
+		return "delete"
+	default:
+		return method
+	}
+}
+
+// GetAuditLog lists the audit log, newest first
+//
+//	?actor=&actorKeyId=&action=&entityType=&entityId=&since=&until=
+func GetAuditLog(context *gin.Context) {
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+
+	conn := db.(*sql.DB)
+
+	opts, err := listOptionsFromQuery(context, "actor", "actorKeyId", "action", "entityType", "entityId")
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var filter database.AuditFilter
+	if since := context.Query("since"); since != "" {
+		filter.Since, err = time.Parse(time.RFC3339, since)
+		if err != nil {
+			context.JSON(http.StatusBadRequest, gin.H{"error": "since must be an RFC 3339 time"})
+			return
+		}
+	}
+	if until := context.Query("until"); until != "" {
+		filter.Until, err = time.Parse(time.RFC3339, until)
+		if err != nil {
+			context.JSON(http.StatusBadRequest, gin.H{"error": "until must be an RFC 3339 time"})
+			return
+		}
+	}
+
+	entries, err := database.ListAuditLog(conn, opts, filter)
+	if err != nil {
+		log.Printf("Error listing audit log: %v", err)
+		respondListError(context, err, "Server failed to retrieve audit log")
+		return
+	}
+
+	context.JSON(http.StatusOK, entries)
+}
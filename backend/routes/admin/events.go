@@ -5,6 +5,7 @@ import (
 	"log"
 	"net/http"
 	"prorickey/nctsa/database"
+	"prorickey/nctsa/scheduler"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -54,6 +55,9 @@ func PostEvent(context *gin.Context) {
 	event.CreatedAt = createdAt
 
 	database.AddEventToCache(event)
+	if !audit(context, "", "event", event.ID, nil, event) {
+		return
+	}
 
 	context.JSON(http.StatusOK, gin.H{"message": "Event created", "event": event})
 }
@@ -75,7 +79,18 @@ func UpdateEvent(context *gin.Context) {
 
 	conn := db.(*sql.DB)
 
-	_, err := conn.Exec(`UPDATE "event" SET name=$1, location=$2, "startTime"=$3, "endTime"=$4 WHERE id=$5`,
+	before, err := database.GetEvent(conn, id)
+	if err == sql.ErrNoRows {
+		context.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading event %s: %v", id, err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update event"})
+		return
+	}
+
+	_, err = conn.Exec(`UPDATE "event" SET name=$1, location=$2, "startTime"=$3, "endTime"=$4 WHERE id=$5`,
 		event.Name, event.Location, event.StartTime, event.EndTime, id)
 
 	if err != nil {
@@ -86,12 +101,45 @@ func UpdateEvent(context *gin.Context) {
 
 	// Make sure to set the ID before updating the cache
 	event.ID = id
+	event.CreatedAt = before.CreatedAt
 	database.UpdateEventInCache(event)
+	if !audit(context, "", "event", id, before, event) {
+		return
+	}
+	scheduler.EventChanged(conn, before, event)
 
 	context.JSON(http.StatusOK, gin.H{"message": "Event updated", "event": event})
 }
 
-// DeleteEvent deletes an event
+// GetEventDeletePreview shows what deleting an event would take with it
+func GetEventDeletePreview(context *gin.Context) {
+	id := context.Param("id")
+
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+
+	conn := db.(*sql.DB)
+
+	if !database.EventExists(conn, id) {
+		context.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return
+	}
+
+	cascade, err := database.PreviewEventDelete(conn, id)
+	if err != nil {
+		log.Printf("Error previewing event delete: %v", err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to preview event delete"})
+		return
+	}
+
+	context.JSON(http.StatusOK, cascade)
+}
+
+// DeleteEvent moves an event and its schedule to the trash. If anything else depends on
+// the event the request has to confirm it with ?cascade=true.
 func DeleteEvent(context *gin.Context) {
 	id := context.Param("id")
 
@@ -103,7 +151,30 @@ func DeleteEvent(context *gin.Context) {
 
 	conn := db.(*sql.DB)
 
-	_, err := conn.Exec(`DELETE FROM "event" WHERE id=$1`, id)
+	before, err := database.GetEvent(conn, id)
+	if err == sql.ErrNoRows {
+		context.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading event %s: %v", id, err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete event"})
+		return
+	}
+
+	cascade, err := database.PreviewEventDelete(conn, id)
+	if err != nil {
+		log.Printf("Error previewing event delete: %v", err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete event"})
+		return
+	}
+
+	if !cascade.Empty() && context.Query("cascade") != "true" {
+		context.JSON(http.StatusConflict, gin.H{"error": "Event has dependent items, retry with ?cascade=true to delete them too", "cascade": cascade})
+		return
+	}
+
+	_, err = database.SoftDeleteEvent(conn, id)
 	if err != nil {
 		log.Printf("Error deleting event: %v", err)
 		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete event"})
@@ -111,6 +182,9 @@ func DeleteEvent(context *gin.Context) {
 	}
 
 	database.DeleteEventFromCache(id)
+	if !audit(context, "", "event", id, before, nil) {
+		return
+	}
 
-	context.JSON(http.StatusOK, gin.H{"message": "Event deleted"})
+	context.JSON(http.StatusOK, gin.H{"message": "Event deleted", "cascade": cascade})
 }
\ No newline at end of file
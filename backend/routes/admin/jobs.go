@@ -0,0 +1,92 @@
+package admin
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"prorickey/nctsa/jobs"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetJobs lists the background jobs along with their last run
+func GetJobs(context *gin.Context) {
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+
+	conn := db.(*sql.DB)
+
+	infos, err := jobs.ListJobs(conn)
+	if err != nil {
+		log.Printf("Error listing jobs: %v", err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Server failed to retrieve jobs"})
+		return
+	}
+
+	context.JSON(http.StatusOK, infos)
+}
+
+// GetJobRuns lists the recent runs of a job, newest first
+func GetJobRuns(context *gin.Context) {
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+
+	conn := db.(*sql.DB)
+
+	limit := 50
+	if l := context.Query("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 {
+			context.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+			return
+		}
+	}
+
+	runs, err := jobs.ListRuns(conn, context.Param("name"), limit)
+	if err != nil {
+		log.Printf("Error listing job runs: %v", err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Server failed to retrieve job runs"})
+		return
+	}
+
+	context.JSON(http.StatusOK, runs)
+}
+
+// PostRunJob makes a job due now, it is picked up within a few seconds
+func PostRunJob(context *gin.Context) {
+	name := context.Param("name")
+
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+
+	conn := db.(*sql.DB)
+
+	err := jobs.RunNow(conn, name)
+	if errors.Is(err, jobs.ErrUnknownJob) {
+		context.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error triggering job %s: %v", name, err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to trigger job"})
+		return
+	}
+
+	if !audit(context, "run", "job", name, nil, nil) {
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"message": "Job triggered"})
+}
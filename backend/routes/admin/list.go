@@ -0,0 +1,50 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"prorickey/nctsa/database"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// listOptionsFromQuery reads the paging, sorting and filtering query parameters
+// shared by the admin list endpoints. Only the given filter keys are picked up.
+//
+//	?search=web&limit=20&cursor=...&sort=name&order=desc&location=Room%20101
+func listOptionsFromQuery(context *gin.Context, filters ...string) (database.ListOptions, error) {
+	opts := database.ListOptions{
+		Search:  context.Query("search"),
+		Cursor:  context.Query("cursor"),
+		Sort:    context.Query("sort"),
+		Desc:    context.Query("order") == "desc",
+		Filters: map[string]string{},
+	}
+
+	if limit := context.Query("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l < 1 {
+			return opts, errors.New("limit must be a positive number")
+		}
+		opts.Limit = l
+	}
+
+	for _, key := range filters {
+		if value, ok := context.GetQuery(key); ok {
+			opts.Filters[key] = value
+		}
+	}
+
+	return opts, nil
+}
+
+// respondListError writes the response for an error returned by a database list function
+func respondListError(context *gin.Context, err error, message string) {
+	if errors.Is(err, database.ErrInvalidListOptions) {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	context.JSON(http.StatusInternalServerError, gin.H{"error": message})
+}
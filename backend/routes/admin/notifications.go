@@ -2,14 +2,17 @@ package admin
 
 import (
 	"database/sql"
+	"errors"
 	"log"
 	"net/http"
 	"prorickey/nctsa/database"
 	"prorickey/nctsa/notifications"
+	"prorickey/nctsa/scheduler"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
-	"github.com/lib/pq"
 )
 
 func GetNotifications(context *gin.Context) {
@@ -22,14 +25,27 @@ func GetNotifications(context *gin.Context) {
 	context.JSON(http.StatusOK, notifications)
 }
 
+// notificationRequest is a notification as the dashboard sends it, a template can
+// fill in the title, description and type that were left empty
+type notificationRequest struct {
+	database.Notification
+	TemplateID string `json:"templateId,omitempty"`
+}
+
 func PostNotifications(context *gin.Context) {
-	var notification database.Notification
-	err := context.BindJSON(&notification)
+	var request notificationRequest
+	err := context.BindJSON(&request)
 	if err != nil {
 		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
 		log.Printf("Error binding notification: %v", err)
 		return
 	}
+	notification := request.Notification
+
+	if err := checkPublishAt(notification.PublishAt, &notification.Published); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
 	db, exists := context.Get("db")
 	if !exists {
@@ -39,25 +55,34 @@ func PostNotifications(context *gin.Context) {
 
 	conn := db.(*sql.DB)
 
-	err = nil
-	if notification.Private {
-		if len(notification.UserIDS) == 0 {
-			context.JSON(http.StatusBadRequest, gin.H{"error": "User IDs are required for private notifications"})
+	if request.TemplateID != "" {
+		template, err := database.GetTemplate(conn, request.TemplateID)
+		if err == sql.ErrNoRows {
+			context.JSON(http.StatusBadRequest, gin.H{"error": "Template not found"})
 			return
-		}
-		uids, err1 := convertStringsToUUIDs(notification.UserIDS)
-		if err1 != nil {
-			context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user IDs"})
-			log.Printf("Error converting user IDs to UUIDs: %v", err)
+		} else if err != nil {
+			log.Printf("Error loading template %s: %v", request.TemplateID, err)
+			context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load template"})
 			return
 		}
-		err = conn.QueryRow(`INSERT INTO "notifications" (title, description, date, published, private, type, userids) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`, 
-		notification.Title, notification.Description, notification.Date, notification.Published, notification.Private, notification.Type, pq.Array(uids)).Scan(&notification.ID)
-	} else {
-		err = conn.QueryRow(`INSERT INTO "notifications" (title, description, date, published) VALUES ($1, $2, $3, $4) RETURNING id`, 
-		notification.Title, notification.Description, notification.Date, notification.Published).Scan(&notification.ID)
+		applyTemplate(&notification, template)
 	}
 
+	if !validNotification(context, conn, &notification) {
+		return
+	}
+
+	status, err := publishingStatus(conn, &notification)
+	if err != nil {
+		log.Printf("Error checking if notification needs approval: %v", err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert notification"})
+		return
+	}
+	notification.Status = status
+	createdByKeyID, createdBy := actor(context)
+	notification.CreatedBy = createdBy
+
+	err = database.InsertNotification(conn, &notification, createdByKeyID)
 	if err != nil {
 		log.Printf("Error inserting notification: %v", err)
 		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert notification"})
@@ -65,24 +90,94 @@ func PostNotifications(context *gin.Context) {
 	}
 
 	database.AddNotificationToCache(notification)
+	if !audit(context, emergencyAction(notification, false), "notification", notification.ID, nil, notification) {
+		return
+	}
+
+	if notification.Status == database.StatusPending {
+		recordReview(context, conn, notification.ID, "submit", "")
+		context.JSON(http.StatusOK, gin.H{"message": "Notification submitted for approval", "notification": notification})
+		return
+	}
 
 	if notification.Published {
-		notifications.SendNotification(conn, notification)
+		scheduler.QueueNotification(conn, notification)
 	}
 
 	context.JSON(http.StatusOK, gin.H{"message": "Notification posted", "notification": notification})
 }
 
-func convertStringsToUUIDs(strings []string) ([]uuid.UUID, error) {
-    var uuids []uuid.UUID
-    for _, str := range strings {
-        uid, err := uuid.Parse(str)
-        if err != nil {
-            return nil, err
-        }
-        uuids = append(uuids, uid)
-    }
-    return uuids, nil
+// emergencyAction is the audit action for saving the notification, emergencies being sent
+// are logged as their own action so they stand out
+func emergencyAction(notification database.Notification, previouslyPublished bool) string {
+	if notification.Type == database.TypeEmergency && notification.Published && !previouslyPublished {
+		return "emergency"
+	}
+	return ""
+}
+
+// validNotification works out the audience of a notification and checks its placeholders
+// before it is saved, writing the error response if there is a problem
+func validNotification(context *gin.Context, conn *sql.DB, notification *database.Notification) bool {
+	if err := database.NormalizeTargets(conn, notification); err != nil {
+		if errors.Is(err, database.ErrInvalidTarget) {
+			context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			log.Printf("Error resolving notification targets: %v", err)
+			context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve notification targets"})
+		}
+		return false
+	}
+
+	if err := database.CheckRichContent(conn, *notification); err != nil {
+		if errors.Is(err, database.ErrInvalidLink) {
+			context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		} else {
+			log.Printf("Error checking notification link: %v", err)
+			context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check notification link"})
+		}
+		return false
+	}
+
+	if err := database.ValidateChannels(notification.Channels); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+
+	if notification.Type == database.TypeEmergency && notification.PublishAt != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Emergency notifications can't be scheduled"})
+		return false
+	}
+	if notification.Type == database.TypeEmergency && notification.Published {
+		// Emergencies skip approval and mutes, so sending one is its own permission
+		keyID, _ := actor(context)
+		allowed, err := database.CanSendEmergencies(conn, keyID)
+		if err != nil {
+			log.Printf("Error checking if key %s can send emergencies: %v", keyID, err)
+			context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check permissions"})
+			return false
+		}
+		if !allowed {
+			context.JSON(http.StatusForbidden, gin.H{"error": "This key can't send emergency notifications"})
+			return false
+		}
+	}
+
+	if notification.EventID != "" {
+		if _, err := uuid.Parse(notification.EventID); err != nil {
+			context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
+			return false
+		}
+	}
+
+	for _, text := range []string{notification.Title, notification.Description} {
+		if err := notifications.CheckPlaceholders(text); err != nil {
+			context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return false
+		}
+	}
+
+	return true
 }
 
 // UpdateNotification updates an existing notification.
@@ -96,67 +191,83 @@ func UpdateNotification(context *gin.Context) {
 		return
 	}
 
+	if err := checkPublishAt(notification.PublishAt, &notification.Published); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	db, exists := context.Get("db")
 	if !exists {
 		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
 		return
 	}
 
-	notis, err2 := database.GetNotificationsCache()
-	if err2 != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve notifications from cache"})
+	conn := db.(*sql.DB)
+
+	before, err := database.GetNotification(conn, id)
+	if err == sql.ErrNoRows {
+		context.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading notification %s: %v", id, err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification"})
+		return
+	}
+	if before.RetractedAt != nil {
+		context.JSON(http.StatusConflict, gin.H{"error": "Retracted notifications can't be edited, send a correction instead"})
 		return
 	}
 
-	// Check if the notification exists in the cache
-	previouslyPublished := false
-	for _, notif := range notis {
-		if notif.ID == id {
-			previouslyPublished = notif.Published
-			break
-		}
+	if !validNotification(context, conn, &notification) {
+		return
 	}
+	previouslyPublished := before.Published
+	editorKeyID, _ := actor(context)
 
-	conn := db.(*sql.DB)
-	
-	var err error
-	if notification.Private {
-		if len(notification.UserIDS) == 0 {
-			context.JSON(http.StatusBadRequest, gin.H{"error": "User IDs are required for private notifications"})
-			return
-		}
-		uids, err1 := convertStringsToUUIDs(notification.UserIDS)
-		if err1 != nil {
-			context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user IDs"})
-			log.Printf("Error converting user IDs to UUIDs: %v", err1)
+	if previouslyPublished && notification.Published {
+		// It has already gone out, editing it doesn't send it again
+		notification.Status = database.StatusSent
+	} else {
+		notification.Status, err = publishingStatus(conn, &notification)
+		if err != nil {
+			log.Printf("Error checking if notification needs approval: %v", err)
+			context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification"})
 			return
 		}
-		_, err = conn.Exec(`UPDATE "notifications" SET title=$1, description=$2, date=$3, published=$4, private=$5, type=$6, userids=$7 WHERE id=$8`,
-			notification.Title, notification.Description, notification.Date, notification.Published, 
-			notification.Private, notification.Type, pq.Array(uids), id)
-	} else {
-		// For non-private notifications, set userids to NULL
-		_, err = conn.Exec(`UPDATE "notifications" SET title=$1, description=$2, date=$3, published=$4, private=$5, type=$6, userids=NULL WHERE id=$7`,
-			notification.Title, notification.Description, notification.Date, notification.Published, 
-			notification.Private, notification.Type, id)
 	}
 
+	notification.ID = id
+	err = database.UpdateNotification(conn, &notification, editorKeyID)
 	if err != nil {
 		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update notification"})
 		log.Printf("Error updating notification: %v", err)
 		return
 	}
 
+	notification.CreatedAt = before.CreatedAt
+	notification.CreatedBy = before.CreatedBy
+	notification.ClearedAt = before.ClearedAt
 	database.UpdateNotificationInCache(notification)
+	if !audit(context, emergencyAction(notification, previouslyPublished), "notification", id, before, notification) {
+		return
+	}
+
+	if notification.Status == database.StatusPending {
+		// Any edit to a notification waiting on approval has to be approved again
+		recordReview(context, conn, id, "submit", "")
+		context.JSON(http.StatusOK, gin.H{"message": "Notification submitted for approval", "notification": notification})
+		return
+	}
 
 	if notification.Published && !previouslyPublished {
-		notifications.SendNotification(conn, notification)
+		scheduler.QueueNotification(conn, notification)
 	}
 
 	context.JSON(http.StatusOK, gin.H{"message": "Notification updated", "notification": notification})
 }
 
-// DeleteNotification deletes an existing notification.
+// DeleteNotification moves an existing notification to the trash.
 func DeleteNotification(context *gin.Context) {
 	id := context.Param("id")
 
@@ -168,7 +279,18 @@ func DeleteNotification(context *gin.Context) {
 
 	conn := db.(*sql.DB)
 
-	_, err := conn.Exec(`DELETE FROM "notifications" WHERE id=$1`, id)
+	before, err := database.GetNotification(conn, id)
+	if err == sql.ErrNoRows {
+		context.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading notification %s: %v", id, err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete notification"})
+		return
+	}
+
+	_, err = database.SoftDeleteNotification(conn, id)
 	if err != nil {
 		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete notification"})
 		log.Printf("Error deleting notification: %v", err)
@@ -176,6 +298,348 @@ func DeleteNotification(context *gin.Context) {
 	}
 
 	database.DeleteNotificationFromCache(id)
+	if !audit(context, "", "notification", id, before, nil) {
+		return
+	}
 
 	context.JSON(http.StatusOK, gin.H{"message": "Notification deleted"})
-}
\ No newline at end of file
+}
+
+// PostNotificationAudience is a dry run of who a notification would reach, it takes
+// the same targets (or private and userids) as creating one
+func PostNotificationAudience(context *gin.Context) {
+	var notification database.Notification
+	if err := context.BindJSON(&notification); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		log.Printf("Error binding notification audience: %v", err)
+		return
+	}
+
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+
+	conn := db.(*sql.DB)
+
+	if !validNotification(context, conn, &notification) {
+		return
+	}
+
+	size, err := database.CountAudience(conn, notification.Targets)
+	if err != nil {
+		log.Printf("Error counting notification audience: %v", err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count audience"})
+		return
+	}
+
+	approval, err := needsApproval(conn, notification)
+	if err != nil {
+		log.Printf("Error checking if notification needs approval: %v", err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count audience"})
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{
+		"targets":       notification.Targets,
+		"users":         size.Users,
+		"devices":       size.Devices,
+		"needsApproval": approval,
+	})
+}
+
+// PostClearEmergency declares an emergency over, it stops being pinned in the app and
+// drops off the status endpoint
+func PostClearEmergency(context *gin.Context) {
+	id := context.Param("id")
+
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+
+	conn := db.(*sql.DB)
+
+	before, err := database.GetNotification(conn, id)
+	if err == sql.ErrNoRows {
+		context.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading notification %s: %v", id, err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear emergency"})
+		return
+	}
+
+	notification, err := database.ClearEmergency(conn, id)
+	if errors.Is(err, database.ErrNotActiveEmergency) {
+		context.JSON(http.StatusConflict, gin.H{"error": "Notification is not an active emergency"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error clearing emergency %s: %v", id, err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear emergency"})
+		return
+	}
+
+	database.UpdateNotificationInCache(notification)
+	if !audit(context, "clear", "notification", id, before, notification) {
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"message": "Emergency cleared", "notification": notification})
+}
+
+// GetNotificationProgress is how far through sending its pushes a notification is
+func GetNotificationProgress(context *gin.Context) {
+	id := context.Param("id")
+
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+
+	progress, err := database.GetPushProgress(db.(*sql.DB), id)
+	if err != nil {
+		log.Printf("Error getting push progress of notification %s: %v", id, err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get progress"})
+		return
+	}
+
+	context.JSON(http.StatusOK, progress)
+}
+
+// GetNotificationDeliveries sums up how the pushes of a notification went, by status and failure reason
+func GetNotificationDeliveries(context *gin.Context) {
+	id := context.Param("id")
+
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+
+	stats, err := database.GetDeliveryStats(db.(*sql.DB), id)
+	if err != nil {
+		log.Printf("Error getting delivery stats of notification %s: %v", id, err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get delivery stats"})
+		return
+	}
+
+	context.JSON(http.StatusOK, stats)
+}
+
+// GetNotificationReads returns how many of the users a notification is for have read it
+func GetNotificationReads(context *gin.Context) {
+	id := context.Param("id")
+
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+
+	conn := db.(*sql.DB)
+
+	notification, err := database.GetNotification(conn, id)
+	if err == sql.ErrNoRows {
+		context.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading notification %s: %v", id, err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get read stats"})
+		return
+	}
+
+	stats, err := database.GetReadStats(conn, notification)
+	if err != nil {
+		log.Printf("Error getting read stats of notification %s: %v", id, err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get read stats"})
+		return
+	}
+
+	context.JSON(http.StatusOK, stats)
+}
+
+// retract pulls back a notification that went out and tells the apps to delete it
+func retract(conn *sql.DB, id string) (database.Notification, error) {
+	notification, err := database.RetractNotification(conn, id)
+	if err != nil {
+		return notification, err
+	}
+
+	database.UpdateNotificationInCache(notification)
+	if err := notifications.SendRetraction(conn, notification); err != nil {
+		log.Printf("Error queueing retraction of notification %s: %v", id, err)
+	}
+
+	return notification, nil
+}
+
+// finishCorrection retracts the notification a correction replaces once the correction
+// is out, so people are left with only the right one. It returns false if the request
+// failed because the retraction couldn't be audited.
+func finishCorrection(context *gin.Context, conn *sql.DB, correction database.Notification) bool {
+	if correction.CorrectsID == "" || !correction.Published {
+		return true
+	}
+
+	original, err := retract(conn, correction.CorrectsID)
+	if errors.Is(err, database.ErrNotRetractable) {
+		// Someone already pulled it back
+		return true
+	}
+	if err != nil {
+		log.Printf("Error retracting notification %s corrected by %s: %v", correction.CorrectsID, correction.ID, err)
+		return true
+	}
+
+	return audit(context, "retract", "notification", original.ID, nil, gin.H{"correctedBy": correction.ID})
+}
+
+// PostRetractNotification pulls back a notification that has gone out. It drops out of
+// everyone's feed, pushes still queued are cancelled and the apps delete their copy.
+func PostRetractNotification(context *gin.Context) {
+	id := context.Param("id")
+
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+
+	conn := db.(*sql.DB)
+
+	before, err := database.GetNotification(conn, id)
+	if err == sql.ErrNoRows {
+		context.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading notification %s: %v", id, err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retract notification"})
+		return
+	}
+
+	notification, err := retract(conn, id)
+	if errors.Is(err, database.ErrNotRetractable) {
+		context.JSON(http.StatusConflict, gin.H{"error": "Only published notifications can be retracted"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error retracting notification %s: %v", id, err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retract notification"})
+		return
+	}
+
+	if !audit(context, "retract", "notification", id, before, notification) {
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"message": "Notification retracted", "notification": notification})
+}
+
+// PostCorrectNotification sends a corrected version of a notification that went out
+// wrong. The correction is titled "Updated: ..." and goes to the same people, and the
+// original is retracted once it is out. It goes through approval like any other notification.
+//
+//	{"title": "...", "description": "..."}
+func PostCorrectNotification(context *gin.Context) {
+	id := context.Param("id")
+
+	var body struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+	}
+	if err := context.BindJSON(&body); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+
+	conn := db.(*sql.DB)
+
+	original, err := database.GetNotification(conn, id)
+	if err == sql.ErrNoRows {
+		context.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading notification %s: %v", id, err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to correct notification"})
+		return
+	}
+	if !original.Published {
+		context.JSON(http.StatusConflict, gin.H{"error": "Only published notifications can be corrected, edit it instead"})
+		return
+	}
+
+	if body.Title == "" {
+		body.Title = original.Title
+	}
+	if body.Description == "" {
+		body.Description = original.Description
+	}
+
+	correction := database.Notification{
+		Title:       "Updated: " + strings.TrimPrefix(body.Title, "Updated: "),
+		Description: body.Description,
+		Date:        time.Now(),
+		Published:   true,
+		Targets:     original.Targets,
+		Type:        original.Type,
+		EventID:     original.EventID,
+		Link:        original.Link,
+		ImageURL:    original.ImageURL,
+		Category:    original.Category,
+		Channels:    original.Channels,
+		CorrectsID:  original.ID,
+	}
+
+	if !validNotification(context, conn, &correction) {
+		return
+	}
+
+	status, err := publishingStatus(conn, &correction)
+	if err != nil {
+		log.Printf("Error checking if notification needs approval: %v", err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to correct notification"})
+		return
+	}
+	correction.Status = status
+	createdByKeyID, createdBy := actor(context)
+	correction.CreatedBy = createdBy
+
+	if err := database.InsertNotification(conn, &correction, createdByKeyID); err != nil {
+		log.Printf("Error inserting correction of notification %s: %v", id, err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to correct notification"})
+		return
+	}
+
+	database.AddNotificationToCache(correction)
+	if !audit(context, "correct", "notification", correction.ID, original, correction) {
+		return
+	}
+
+	if correction.Status == database.StatusPending {
+		recordReview(context, conn, correction.ID, "submit", "")
+		context.JSON(http.StatusOK, gin.H{"message": "Correction submitted for approval", "notification": correction})
+		return
+	}
+
+	scheduler.QueueNotification(conn, correction)
+	if !finishCorrection(context, conn, correction) {
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"message": "Correction sent", "notification": correction})
+}
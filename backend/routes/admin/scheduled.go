@@ -0,0 +1,91 @@
+package admin
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"prorickey/nctsa/database"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var errPublishAtInPast = errors.New("publishAt must be in the future")
+
+// checkPublishAt validates a requested publish time. Scheduled items stay
+// unpublished until the scheduler publishes them.
+func checkPublishAt(publishAt *time.Time, published *bool) error {
+	if publishAt == nil {
+		return nil
+	}
+	if !publishAt.After(time.Now()) {
+		return errPublishAtInPast
+	}
+
+	*published = false
+	return nil
+}
+
+// GetScheduled lists the agenda items and notifications waiting to be published
+func GetScheduled(context *gin.Context) {
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+
+	conn := db.(*sql.DB)
+
+	items, err := database.ListScheduled(conn)
+	if err != nil {
+		log.Printf("Error listing scheduled items: %v", err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Server failed to retrieve scheduled items"})
+		return
+	}
+
+	context.JSON(http.StatusOK, items)
+}
+
+// DeleteScheduled cancels the scheduled publishing of an agenda item or notification,
+// the item itself is kept unpublished
+func DeleteScheduled(context *gin.Context) {
+	itemType := context.Param("type")
+	id := context.Param("id")
+
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+
+	conn := db.(*sql.DB)
+
+	err := database.CancelScheduled(conn, itemType, id)
+	if errors.Is(err, database.ErrNotScheduled) {
+		context.JSON(http.StatusNotFound, gin.H{"error": "Scheduled item not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error cancelling scheduled %s %s: %v", itemType, id, err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel scheduled item"})
+		return
+	}
+
+	switch itemType {
+	case "agenda":
+		if agenda, err := database.GetAgendaItem(conn, id); err == nil && agenda.EventId == "" {
+			database.UpdateAgendaItemInCache(agenda)
+		}
+	case "notification":
+		if notification, err := database.GetNotification(conn, id); err == nil {
+			database.UpdateNotificationInCache(notification)
+		}
+	}
+
+	if !audit(context, "cancel_schedule", itemType, id, nil, nil) {
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"message": "Scheduled publishing cancelled"})
+}
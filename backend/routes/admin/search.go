@@ -0,0 +1,54 @@
+package admin
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"prorickey/nctsa/database"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetSearch runs a fuzzy search across users, schools and events and returns the
+// hits ranked together
+func GetSearch(context *gin.Context) {
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+
+	conn := db.(*sql.DB)
+
+	term := strings.TrimSpace(context.Query("q"))
+	if term == "" {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Search term is required"})
+		return
+	}
+
+	types := database.SearchTypes
+	if t := context.Query("types"); t != "" {
+		types = strings.Split(t, ",")
+	}
+
+	limit := 0
+	if l := context.Query("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 {
+			context.JSON(http.StatusBadRequest, gin.H{"error": "limit must be a positive number"})
+			return
+		}
+	}
+
+	results, err := database.Search(conn, term, types, limit)
+	if err != nil {
+		log.Printf("Error searching: %v", err)
+		respondListError(context, err, "Server failed to search")
+		return
+	}
+
+	context.JSON(http.StatusOK, results)
+}
@@ -0,0 +1,228 @@
+package admin
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"prorickey/nctsa/database"
+	"prorickey/nctsa/notifications"
+
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+)
+
+// applyTemplate fills in whatever the notification left empty from the template
+func applyTemplate(notification *database.Notification, template database.NotificationTemplate) {
+	if notification.Title == "" {
+		notification.Title = template.Title
+	}
+	if notification.Description == "" {
+		notification.Description = template.Description
+	}
+	if notification.Type == "" {
+		notification.Type = template.Type
+	}
+}
+
+// isUniqueViolation reports whether the error is postgres refusing a duplicate
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+// validTemplate checks the placeholders in a template, writing the error response if they are wrong
+func validTemplate(context *gin.Context, template database.NotificationTemplate) bool {
+	for _, text := range []string{template.Title, template.Description} {
+		if err := notifications.CheckPlaceholders(text); err != nil {
+			context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return false
+		}
+	}
+
+	return true
+}
+
+func GetTemplates(context *gin.Context) {
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+
+	templates, err := database.GetTemplates(db.(*sql.DB))
+	if err != nil {
+		log.Printf("Error getting templates: %v", err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Server failed to retrieve templates"})
+		return
+	}
+
+	context.JSON(http.StatusOK, templates)
+}
+
+func PostTemplate(context *gin.Context) {
+	var template database.NotificationTemplate
+	if err := context.BindJSON(&template); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		log.Printf("Error binding template: %v", err)
+		return
+	}
+
+	if !validTemplate(context, template) {
+		return
+	}
+
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+
+	template, err := database.CreateTemplate(db.(*sql.DB), template)
+	if isUniqueViolation(err) {
+		context.JSON(http.StatusConflict, gin.H{"error": "A template with that name already exists"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error inserting template: %v", err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to insert template"})
+		return
+	}
+
+	if !audit(context, "", "template", template.ID, nil, template) {
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"message": "Template created", "template": template})
+}
+
+func UpdateTemplate(context *gin.Context) {
+	id := context.Param("id")
+
+	var template database.NotificationTemplate
+	if err := context.BindJSON(&template); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		log.Printf("Error binding template: %v", err)
+		return
+	}
+
+	if !validTemplate(context, template) {
+		return
+	}
+
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+
+	conn := db.(*sql.DB)
+
+	before, err := database.GetTemplate(conn, id)
+	if err == sql.ErrNoRows {
+		context.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading template %s: %v", id, err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update template"})
+		return
+	}
+
+	template.ID = id
+	template, err = database.UpdateTemplate(conn, template)
+	if isUniqueViolation(err) {
+		context.JSON(http.StatusConflict, gin.H{"error": "A template with that name already exists"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating template %s: %v", id, err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update template"})
+		return
+	}
+
+	if !audit(context, "", "template", id, before, template) {
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"message": "Template updated", "template": template})
+}
+
+func DeleteTemplate(context *gin.Context) {
+	id := context.Param("id")
+
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+
+	conn := db.(*sql.DB)
+
+	before, err := database.GetTemplate(conn, id)
+	if err == sql.ErrNoRows {
+		context.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading template %s: %v", id, err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete template"})
+		return
+	}
+
+	if _, err := database.DeleteTemplate(conn, id); err != nil {
+		log.Printf("Error deleting template %s: %v", id, err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete template"})
+		return
+	}
+
+	if !audit(context, "", "template", id, before, nil) {
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"message": "Template deleted"})
+}
+
+// PostPreviewTemplate renders a template the way a user would see it
+//
+//	{"eventId": "...", "userId": "..."}
+func PostPreviewTemplate(context *gin.Context) {
+	id := context.Param("id")
+
+	var body struct {
+		EventID string `json:"eventId"`
+		UserID  string `json:"userId"`
+	}
+	if err := context.ShouldBindJSON(&body); err != nil && context.Request.ContentLength > 0 {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+
+	conn := db.(*sql.DB)
+
+	template, err := database.GetTemplate(conn, id)
+	if err == sql.ErrNoRows {
+		context.JSON(http.StatusNotFound, gin.H{"error": "Template not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error loading template %s: %v", id, err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load template"})
+		return
+	}
+
+	renderer := notifications.NewRenderer(conn, database.Notification{
+		Title:       template.Title,
+		Description: template.Description,
+		EventID:     body.EventID,
+	})
+	title, description := renderer.For(body.UserID)
+
+	context.JSON(http.StatusOK, gin.H{"title": title, "description": description})
+}
@@ -0,0 +1,97 @@
+package admin
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"prorickey/nctsa/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetTrash lists the soft deleted agenda items, events and notifications
+//
+//	?type=agenda|event|notification
+func GetTrash(context *gin.Context) {
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+
+	conn := db.(*sql.DB)
+
+	opts, err := listOptionsFromQuery(context, "type")
+	if err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	items, err := database.ListTrash(conn, opts)
+	if err != nil {
+		log.Printf("Error listing trash: %v", err)
+		respondListError(context, err, "Server failed to retrieve trash")
+		return
+	}
+
+	context.JSON(http.StatusOK, items)
+}
+
+// PostRestoreFromTrash takes an agenda item, event or notification back out of the trash
+func PostRestoreFromTrash(context *gin.Context) {
+	itemType := context.Param("type")
+	id := context.Param("id")
+
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+
+	conn := db.(*sql.DB)
+
+	err := database.RestoreFromTrash(conn, itemType, id)
+	if errors.Is(err, database.ErrNotInTrash) {
+		context.JSON(http.StatusNotFound, gin.H{"error": "Item not found in trash"})
+		return
+	}
+	if errors.Is(err, database.ErrParentInTrash) {
+		context.JSON(http.StatusConflict, gin.H{"error": "Restore the event this agenda item belongs to first"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error restoring %s %s: %v", itemType, id, err)
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to restore item"})
+		return
+	}
+
+	// Put it back into the cache so it shows up straight away
+	var restored any
+	switch itemType {
+	case "agenda":
+		agenda, err := database.GetAgendaItem(conn, id)
+		if err == nil && agenda.EventId == "" {
+			database.AddAgendaItemToCache(agenda)
+		}
+		restored = agenda
+	case "event":
+		event, err := database.GetEvent(conn, id)
+		if err == nil {
+			database.AddEventToCache(event)
+		}
+		restored = event
+	case "notification":
+		notification, err := database.GetNotification(conn, id)
+		if err == nil {
+			database.AddNotificationToCache(notification)
+		}
+		restored = notification
+	}
+
+	if !audit(context, "restore", itemType, id, nil, restored) {
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"message": "Item restored", "item": restored})
+}
@@ -2,6 +2,7 @@ package admin
 
 import (
 	"database/sql"
+	"log"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
@@ -17,18 +18,17 @@ func GetUsers(context *gin.Context) {
 
 	conn := db.(*sql.DB)
 	
-	// Get search query parameter (empty string if not provided)
-	searchTerm := context.Query("search")
-
-	users, err := database.GetUsers(conn, searchTerm)
+	opts, err := listOptionsFromQuery(context, "id", "schoolId", "tsaId", "role")
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"error": "Server failed to retrieve users"})
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Limit the number of results returned for performance when searching
-	if searchTerm != "" && len(users) > 20 {
-		users = users[:20]
+	users, err := database.ListUsers(conn, opts)
+	if err != nil {
+		log.Printf("Error listing users: %v", err)
+		respondListError(context, err, "Server failed to retrieve users")
+		return
 	}
 
 	context.JSON(http.StatusOK, users)
@@ -43,18 +43,17 @@ func GetSchools(context *gin.Context) {
 
 	conn := db.(*sql.DB)
 	
-	// Get search query parameter (empty string if not provided)
-	searchTerm := context.Query("search")
-
-	schools, err := database.GetSchools(conn, searchTerm)
+	opts, err := listOptionsFromQuery(context, "id", "tsaId", "privateCode")
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"error": "Server failed to retrieve schools"})
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Limit the number of results returned for performance when searching
-	if searchTerm != "" && len(schools) > 20 {
-		schools = schools[:20]
+	schools, err := database.ListSchools(conn, opts)
+	if err != nil {
+		log.Printf("Error listing schools: %v", err)
+		respondListError(context, err, "Server failed to retrieve schools")
+		return
 	}
 
 	context.JSON(http.StatusOK, schools)
@@ -69,17 +68,17 @@ func GetSearchEvents(context *gin.Context) {
 
 	conn := db.(*sql.DB)
 	
-	// Get search query parameter (empty string if not provided)
-	searchTerm := context.Query("search")
-	events, err := database.GetAllEvents(conn, searchTerm)
+	opts, err := listOptionsFromQuery(context, "id", "location")
 	if err != nil {
-		context.JSON(http.StatusInternalServerError, gin.H{"error": "Server failed to retrieve events"})
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Limit the number of results returned for performance when searching
-	if searchTerm != "" && len(events) > 20 {
-		events = events[:20]
+	events, err := database.ListEvents(conn, opts)
+	if err != nil {
+		log.Printf("Error listing events: %v", err)
+		respondListError(context, err, "Server failed to retrieve events")
+		return
 	}
 
 	context.JSON(http.StatusOK, events)
@@ -206,4 +206,102 @@ func DeleteRemoveEventFromUserAgenda(context *gin.Context) {
 	}
 
 	context.JSON(http.StatusOK, gin.H{"message": "Event removed from personal agenda"})
-}
\ No newline at end of file
+}
+// GetFavorites returns the ids of the general agenda items the user has favorited
+func GetFavorites(context *gin.Context) {
+	userID, exists := context.Get("user_id")
+	if !exists {
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+	conn := db.(*sql.DB)
+
+	favorites, err := database.GetFavorites(conn, userID.(string))
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve favorites"})
+		log.Printf("Error retrieving favorites: %v", err)
+		return
+	}
+
+	context.JSON(http.StatusOK, favorites)
+}
+
+// PostFavorite favorites a general agenda item so the user gets reminded about it
+func PostFavorite(context *gin.Context) {
+	userID, exists := context.Get("user_id")
+	if !exists {
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var requestBody struct {
+		AgendaID string `json:"agendaId" binding:"required"`
+	}
+
+	if err := context.BindJSON(&requestBody); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		log.Printf("Error binding request: %v", err)
+		return
+	}
+
+	if _, err := uuid.Parse(requestBody.AgendaID); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid agenda ID format"})
+		return
+	}
+
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+	conn := db.(*sql.DB)
+
+	added, err := database.AddFavorite(conn, userID.(string), requestBody.AgendaID)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add favorite"})
+		log.Printf("Error adding favorite: %v", err)
+		return
+	}
+	if !added {
+		context.JSON(http.StatusNotFound, gin.H{"error": "Agenda item not found"})
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"message": "Agenda item added to favorites"})
+}
+
+// DeleteFavorite takes an agenda item out of the user's favorites
+func DeleteFavorite(context *gin.Context) {
+	userID, exists := context.Get("user_id")
+	if !exists {
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	agendaID := context.Param("id")
+	if _, err := uuid.Parse(agendaID); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid agenda ID format"})
+		return
+	}
+
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+	conn := db.(*sql.DB)
+
+	if err := database.RemoveFavorite(conn, userID.(string), agendaID); err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove favorite"})
+		log.Printf("Error removing favorite: %v", err)
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"message": "Agenda item removed from favorites"})
+}
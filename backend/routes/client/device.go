@@ -4,15 +4,29 @@ import (
 	"database/sql"
 	"log"
 	"net/http"
+	"prorickey/nctsa/database"
+	"prorickey/nctsa/notifications"
 
+	webpush "github.com/SherClockHolmes/webpush-go"
 	"github.com/gin-gonic/gin"
 )
 
+// RegisterDevice registers the device for pushes to the logged in user, the app calls it every
+// launch so it also checks the device in. A token registered to another user moves to this one.
 func RegisterDevice(context *gin.Context) {
+	userID, exists := context.Get("user_id")
+	if !exists {
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
 	var requestBody struct {
-		UserId string `json:"userId" binding:"required"`
 		DeviceType string `json:"deviceType" binding:"required"`
-		DeviceToken string `json:"token" binding:"required"`
+		DeviceToken string `json:"token"`
+		Environment string `json:"environment"` // production (default) or sandbox, which APNs the token is from
+		Subscription *webpush.Subscription `json:"subscription"` // The browser's PushSubscription, for web devices
+		AppVersion string `json:"appVersion"`
+		OSVersion string `json:"osVersion"`
 	}
 
 	if err := context.BindJSON(&requestBody); err != nil {
@@ -21,6 +35,37 @@ func RegisterDevice(context *gin.Context) {
 		return
 	}
 
+	switch requestBody.DeviceType {
+	case database.DeviceIOS, database.DeviceAndroid, database.DeviceWeb:
+	default:
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Device type must be ios, android or web"})
+		return
+	}
+
+	// Browsers don't have a token, the subscription's endpoint stands in for it
+	var p256dh, auth string
+	if requestBody.DeviceType == database.DeviceWeb {
+		sub := requestBody.Subscription
+		if sub == nil || !notifications.ValidWebPushEndpoint(sub.Endpoint) || sub.Keys.P256dh == "" || sub.Keys.Auth == "" {
+			context.JSON(http.StatusBadRequest, gin.H{"error": "Web devices need a subscription with keys and an endpoint on a known push service"})
+			return
+		}
+		requestBody.DeviceToken = sub.Endpoint
+		p256dh, auth = sub.Keys.P256dh, sub.Keys.Auth
+	}
+	if requestBody.DeviceToken == "" {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if requestBody.Environment == "" {
+		requestBody.Environment = notifications.EnvironmentProduction
+	}
+	if requestBody.Environment != notifications.EnvironmentProduction && requestBody.Environment != notifications.EnvironmentSandbox {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Environment must be production or sandbox"})
+		return
+	}
+
 	// Get database connection
 	db, exists := context.Get("db")
 	if !exists {
@@ -29,12 +74,93 @@ func RegisterDevice(context *gin.Context) {
 	}
 	conn := db.(*sql.DB)
 
-	_, err := conn.Exec(`INSERT INTO public.devices (userId, deviceType, token) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`, requestBody.UserId, requestBody.DeviceType, requestBody.DeviceToken)
+	previousUserID, err := database.RegisterDevice(conn, database.Device{
+		UserID:      userID.(string),
+		DeviceType:  requestBody.DeviceType,
+		Token:       requestBody.DeviceToken,
+		Environment: requestBody.Environment,
+		WebP256dh:   p256dh,
+		WebAuth:     auth,
+		AppVersion:  requestBody.AppVersion,
+		OSVersion:   requestBody.OSVersion,
+	})
 	if err != nil {
 		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register device"})
 		log.Printf("Error registering device: %v", err)
 		return
 	}
+	if previousUserID != "" {
+		log.Printf("Device %s moved from user %s to %s", database.MaskToken(requestBody.DeviceToken), previousUserID, userID)
+	}
 
 	context.JSON(http.StatusOK, gin.H{"message": "Device registered successfully"})
 }
+
+// DeleteDevice unregisters the user's device when they log out, so it stops getting their pushes
+func DeleteDevice(context *gin.Context) {
+	userID, exists := context.Get("user_id")
+	if !exists {
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var requestBody struct {
+		DeviceToken string `json:"token"`
+		Endpoint string `json:"endpoint"` // For web devices
+	}
+
+	if err := context.BindJSON(&requestBody); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		log.Printf("Error binding request: %v", err)
+		return
+	}
+
+	token := requestBody.DeviceToken
+	if token == "" {
+		token = requestBody.Endpoint
+	}
+	if token == "" {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "A token or endpoint is required"})
+		return
+	}
+
+	// Get database connection
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+	conn := db.(*sql.DB)
+
+	removed, err := database.UnregisterDevice(conn, userID.(string), token)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to unregister device"})
+		log.Printf("Error unregistering device: %v", err)
+		return
+	}
+	if !removed {
+		context.JSON(http.StatusNotFound, gin.H{"error": "Device not found"})
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"message": "Device unregistered"})
+}
+
+// GetWebPushKey returns the VAPID public key browsers subscribe to web push with
+func GetWebPushKey(context *gin.Context) {
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+	conn := db.(*sql.DB)
+
+	keys, err := notifications.VAPIDKeys(conn)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get web push key"})
+		log.Printf("Error getting VAPID keys: %v", err)
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"publicKey": keys.Public})
+}
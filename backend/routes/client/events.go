@@ -9,8 +9,13 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// GetAgenda returns all published agenda items (general agenda)
+// GetEvents returns all the events, or the events best matching ?search= when given
 func GetEvents(context *gin.Context) {
+	if search := context.Query("search"); search != "" {
+		searchEvents(context, search)
+		return
+	}
+
 	events, err := database.GetEventCache()
 
 	if err != nil {
@@ -26,6 +31,25 @@ func GetEvents(context *gin.Context) {
 	context.JSON(http.StatusOK, events)
 }
 
+// searchEvents runs the same fuzzy search the admin panel uses over the events
+func searchEvents(context *gin.Context, search string) {
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+	conn := db.(*sql.DB)
+
+	events, err := database.SearchEvents(conn, search, database.MaxPageLimit)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to search events"})
+		log.Printf("Error searching events: %v", err)
+		return
+	}
+
+	context.JSON(http.StatusOK, events)
+}
+
 func GetEventSchedules(context *gin.Context) {
 	// Get the event ID from the URL parameter
 	eventID := context.Param("id")
@@ -42,7 +66,7 @@ func GetEventSchedules(context *gin.Context) {
 	}
 	conn := db.(*sql.DB)
 
-	rows, err := conn.Query("SELECT id, title, description, date, endtime, location, published, icon, createdAt FROM agenda WHERE eventid = $1", eventID)
+	rows, err := conn.Query("SELECT id, title, description, date, endtime, location, published, icon, createdAt FROM agenda WHERE eventid = $1 AND deletedAt IS NULL", eventID)
 	if err != nil {
 		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve event schedules"})
 		return
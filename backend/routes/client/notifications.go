@@ -5,71 +5,172 @@ import (
 	"log"
 	"net/http"
 	"prorickey/nctsa/database"
+	"prorickey/nctsa/notifications"
+	"sort"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 )
 
 func GetNotifications(context *gin.Context) {
-	notifications, err := database.GetNotificationsCache()
+	cached, err := database.GetNotificationsCache()
 	if err != nil {
 		context.JSON(http.StatusInternalServerError, gin.H{"error": "Server failed to retrieve cache"})
 		return
 	}
 
-	published := make([]database.Notification, 0)
-	for _, item := range notifications {
-		if item.Published {
-			if item.Private {
-				userID, exists := context.Get("user_id")
-				if !exists {
-					context.JSON(http.StatusUnauthorized, gin.H{"error": "User not authorized"})
-					return
-				}
-				userIDStr, ok := userID.(string)
-				if !ok {
-					context.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
-					return
-				}
+	userID, exists := context.Get("user_id")
+	if !exists {
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "User not authorized"})
+		return
+	}
+	userIDStr, ok := userID.(string)
+	if !ok {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Invalid user ID"})
+		return
+	}
 
-				db, exists := context.Get("db")
-				if !exists {
-					context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
-					return
-				}
-				conn := db.(*sql.DB)
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+	conn := db.(*sql.DB)
 
-				userEventAgenda, err := database.RetrieveUserAgenda(conn, userIDStr)
-				if err != nil {
-					context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve user event agenda"})
-					log.Printf("Error retrieving user event agenda (2): %v", err)
-					return
-				}
+	// Which of the targeted notifications the user is in the audience of, only
+	// looked up if there are any
+	var visible map[string]bool
 
-				authorized := false
-				for _, id := range item.UserIDS {
-					if id == userIDStr {
-						authorized = true
-						break
-					}
+	renderer := notifications.NewFeedRenderer(conn, userIDStr)
 
-					for _, agendaItem := range userEventAgenda {
-						if agendaItem.EventId == id {
-							authorized = true
-							break
-						}
+	published := make([]database.Notification, 0)
+	for _, item := range cached {
+		if item.Published {
+			if !database.TargetsAll(item.Targets) {
+				if visible == nil {
+					visible, err = database.VisibleNotificationIDs(conn, userIDStr)
+					if err != nil {
+						context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve notifications"})
+						log.Printf("Error retrieving visible notifications: %v", err)
+						return
 					}
 				}
 
-				if !authorized {
+				if !visible[item.ID] {
 					continue
 				}
-
-				item.UserIDS = nil // Remove user IDs from the response
 			}
 
-			published = append(published, item)
+			item.Targets = nil // Remove who else it went to from the response
+			published = append(published, renderer.Render(item))
 		}
 	}
 
+	read, err := database.ReadNotificationIDs(conn, userIDStr)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve notifications"})
+		log.Printf("Error retrieving read notifications: %v", err)
+		return
+	}
+	for i := range published {
+		isRead := read[published[i].ID]
+		published[i].Read = &isRead
+	}
+
+	// Emergencies stay pinned at the top until they are cleared
+	sort.SliceStable(published, func(i, j int) bool {
+		return published[i].IsActiveEmergency() && !published[j].IsActiveEmergency()
+	})
+
 	context.JSON(http.StatusOK, published)
-}
\ No newline at end of file
+}
+
+// GetUnreadCount returns how many notifications the user hasn't read, for the badge
+func GetUnreadCount(context *gin.Context) {
+	userID, exists := context.Get("user_id")
+	if !exists {
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+	conn := db.(*sql.DB)
+
+	unread, err := database.UnreadCount(conn, userID.(string))
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count unread notifications"})
+		log.Printf("Error counting unread notifications: %v", err)
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"unread": unread})
+}
+
+// PostNotificationRead marks a notification read for the user
+func PostNotificationRead(context *gin.Context) {
+	userID, exists := context.Get("user_id")
+	if !exists {
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	notificationID := context.Param("id")
+	if _, err := uuid.Parse(notificationID); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid notification ID format"})
+		return
+	}
+
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+	conn := db.(*sql.DB)
+
+	found, err := database.MarkNotificationRead(conn, userID.(string), notificationID)
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark notification read"})
+		log.Printf("Error marking notification read: %v", err)
+		return
+	}
+	if !found {
+		context.JSON(http.StatusNotFound, gin.H{"error": "Notification not found"})
+		return
+	}
+
+	unread, err := database.UnreadCount(conn, userID.(string))
+	if err != nil {
+		log.Printf("Error counting unread notifications: %v", err)
+	}
+
+	context.JSON(http.StatusOK, gin.H{"message": "Notification marked read", "unread": unread})
+}
+
+// PostReadAllNotifications marks every notification the user can see read
+func PostReadAllNotifications(context *gin.Context) {
+	userID, exists := context.Get("user_id")
+	if !exists {
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+	conn := db.(*sql.DB)
+
+	marked, err := database.MarkAllNotificationsRead(conn, userID.(string))
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mark notifications read"})
+		log.Printf("Error marking all notifications read: %v", err)
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"message": "All notifications marked read", "marked": marked, "unread": 0})
+}
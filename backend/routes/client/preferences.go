@@ -0,0 +1,78 @@
+package client
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"prorickey/nctsa/database"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetPreferences returns the user's settings
+func GetPreferences(context *gin.Context) {
+	userID, exists := context.Get("user_id")
+	if !exists {
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+	conn := db.(*sql.DB)
+
+	prefs, err := database.GetPreferences(conn, userID.(string))
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve preferences"})
+		log.Printf("Error retrieving preferences: %v", err)
+		return
+	}
+
+	context.JSON(http.StatusOK, prefs)
+}
+
+// PutPreferences changes the user's settings, anything left out of the body stays as it was
+func PutPreferences(context *gin.Context) {
+	userID, exists := context.Get("user_id")
+	if !exists {
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+	conn := db.(*sql.DB)
+
+	prefs, err := database.GetPreferences(conn, userID.(string))
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve preferences"})
+		log.Printf("Error retrieving preferences: %v", err)
+		return
+	}
+
+	if err := context.BindJSON(&prefs); err != nil {
+		context.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		log.Printf("Error binding request: %v", err)
+		return
+	}
+
+	if err := prefs.Validate(); errors.Is(err, database.ErrInvalidPreferences) {
+		context.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := database.SavePreferences(conn, userID.(string), prefs); err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save preferences"})
+		log.Printf("Error saving preferences: %v", err)
+		return
+	}
+
+	context.JSON(http.StatusOK, gin.H{"message": "Preferences saved", "preferences": prefs})
+}
@@ -0,0 +1,126 @@
+package client
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"prorickey/nctsa/auth"
+	"prorickey/nctsa/stream"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/redis/go-redis/v9"
+)
+
+// How often an idle stream gets a comment to keep proxies from closing it. The token is
+// checked again each time, so the stream ends soon after it expires.
+const streamHeartbeat = 25 * time.Second
+
+// GetStream sends changes to the agenda, events and notifications the user can see as
+// server-sent events so the app can refetch them. Apps resume with Last-Event-ID (or
+// ?cursor=) after reconnecting, a reset event means the cursor is too old to resume from.
+func GetStream(context *gin.Context) {
+	userID, exists := context.Get("user_id")
+	if !exists {
+		context.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+	userIDStr := userID.(string)
+
+	db, exists := context.Get("db")
+	if !exists {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Database connection error"})
+		return
+	}
+	conn := db.(*sql.DB)
+	rdb := context.MustGet("rdb").(*redis.Client)
+
+	cursor := context.GetHeader("Last-Event-ID")
+	if cursor == "" {
+		cursor = context.Query("cursor")
+	}
+
+	// Subscribe before catching up so nothing slips through in between, anything
+	// caught up on is skipped when it comes in live
+	client := stream.Subscribe(userIDStr)
+	defer stream.Unsubscribe(client)
+
+	var replay []stream.Event
+	reset := false
+	if cursor != "" {
+		var err error
+		replay, err = stream.Since(conn, rdb, userIDStr, cursor)
+		if err == stream.ErrCursorExpired {
+			reset = true
+		} else if err != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resume stream"})
+			log.Printf("Error resuming stream for user %s from %s: %v", userIDStr, cursor, err)
+			return
+		}
+	}
+	if cursor == "" || reset {
+		latest, err := stream.Latest(rdb)
+		if err != nil {
+			context.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start stream"})
+			log.Printf("Error starting stream for user %s: %v", userIDStr, err)
+			return
+		}
+		cursor = latest
+	}
+
+	header := context.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no") // nginx would hold the events back otherwise
+	context.Status(http.StatusOK)
+
+	if reset {
+		writeStreamEvent(context, cursor, "reset", gin.H{})
+	}
+	for _, event := range replay {
+		writeStreamEvent(context, event.Cursor, event.Name(), event)
+		cursor = event.Cursor
+	}
+	writeStreamEvent(context, cursor, "ready", gin.H{})
+
+	token := context.GetHeader("Authorization")
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-context.Request.Context().Done():
+			return
+		case <-client.Lagged:
+			// The app reconnects with its cursor and catches up from the stream
+			return
+		case event := <-client.Events:
+			if !stream.After(event.Cursor, cursor) {
+				continue
+			}
+			writeStreamEvent(context, event.Cursor, event.Name(), event)
+			cursor = event.Cursor
+		case <-heartbeat.C:
+			if id, _ := auth.ValidateUserToken(rdb, token); id != userIDStr {
+				writeStreamEvent(context, cursor, "expired", gin.H{})
+				return
+			}
+			fmt.Fprint(context.Writer, ": ping\n\n")
+			context.Writer.Flush()
+		}
+	}
+}
+
+func writeStreamEvent(context *gin.Context, id string, name string, data interface{}) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		log.Printf("Error encoding stream event %s: %v", id, err)
+		return
+	}
+
+	fmt.Fprintf(context.Writer, "id: %s\nevent: %s\ndata: %s\n\n", id, name, raw)
+	context.Writer.Flush()
+}
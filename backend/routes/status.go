@@ -0,0 +1,61 @@
+package routes
+
+import (
+	"database/sql"
+	"net/http"
+	"prorickey/nctsa/database"
+	"prorickey/nctsa/notifications"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// EmergencyStatus is an emergency as the status endpoint shows it
+type EmergencyStatus struct {
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Date        time.Time `json:"date"`
+}
+
+// GetStatus is polled by the app as a fallback for when pushes don't arrive. It
+// doesn't need a login, so only emergencies sent to everyone are on it.
+func GetStatus(context *gin.Context) {
+	emergencies, err := database.GetActiveEmergencies()
+	if err != nil {
+		context.JSON(http.StatusInternalServerError, gin.H{"error": "Server failed to retrieve cache"})
+		return
+	}
+
+	// Nobody is logged in here, so only the event placeholders are filled in
+	var conn *sql.DB
+	if db, exists := context.Get("db"); exists {
+		conn = db.(*sql.DB)
+	}
+	renderer := notifications.NewFeedRenderer(conn, "")
+
+	active := make([]EmergencyStatus, 0)
+	for _, emergency := range emergencies {
+		if !database.TargetsAll(emergency.Targets) {
+			continue
+		}
+
+		rendered := renderer.Render(emergency)
+
+		active = append(active, EmergencyStatus{
+			ID:          emergency.ID,
+			Title:       rendered.Title,
+			Description: rendered.Description,
+			Date:        emergency.Date,
+		})
+	}
+
+	status := "ok"
+	if len(active) > 0 {
+		status = "emergency"
+	}
+
+	// Every app polls this, let proxies take some of the load
+	context.Header("Cache-Control", "public, max-age=15")
+	context.JSON(http.StatusOK, gin.H{"status": status, "emergencies": active})
+}
@@ -0,0 +1,204 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"prorickey/nctsa/database"
+	"prorickey/nctsa/jobs"
+)
+
+/*
+When the time or room of an event, or of one of its schedule items, changes the
+people following the event get a notification about it. Edits tend to come in
+bursts, so the notification waits for changeDebounce after the last edit. The
+pending job keeps the state from before the first edit, and when it runs that
+is compared with how things ended up, so edits that cancel out send nothing.
+*/
+
+const changeDebounce = 2 * time.Minute
+
+// slot is the part of an event or schedule item followers care about
+type slot struct {
+	Title    string    `json:"title"`
+	Location string    `json:"location"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+}
+
+func (s slot) moved(other slot) bool {
+	return s.Location != other.Location
+}
+
+func (s slot) retimed(other slot) bool {
+	return !s.Start.Equal(other.Start) || !s.End.Equal(other.End)
+}
+
+// scheduleChange is the payload of a pending change notification
+type scheduleChange struct {
+	EventID string          `json:"eventId"`
+	Event   *slot           `json:"event,omitempty"` // The event before it changed
+	Items   map[string]slot `json:"items,omitempty"` // Schedule items before they changed, by id
+}
+
+func eventSlot(event database.Event) slot {
+	return slot{Title: event.Name, Location: event.Location, Start: event.StartTime, End: event.EndTime}
+}
+
+func agendaSlot(item database.Agenda) slot {
+	return slot{Title: item.Title, Location: item.Location, Start: item.Date, End: item.EndTime}
+}
+
+func changeJobName(eventID string) string {
+	return "event-changed:" + eventID
+}
+
+// EventChanged queues a notification to the event's followers if its time or room changed
+func EventChanged(db *sql.DB, before database.Event, after database.Event) {
+	old, now := eventSlot(before), eventSlot(after)
+	if !old.moved(now) && !old.retimed(now) {
+		return
+	}
+
+	queueChange(db, before.ID, func(change *scheduleChange) {
+		if change.Event == nil {
+			change.Event = &old
+		}
+	})
+}
+
+// AgendaItemChanged queues a notification to the followers of the event a published
+// schedule item belongs to if its time or room changed
+func AgendaItemChanged(db *sql.DB, before database.Agenda, after database.Agenda) {
+	if before.EventId == "" || !before.Published {
+		return
+	}
+
+	old, now := agendaSlot(before), agendaSlot(after)
+	if !old.moved(now) && !old.retimed(now) {
+		return
+	}
+
+	queueChange(db, before.EventId, func(change *scheduleChange) {
+		if _, ok := change.Items[before.ID]; !ok {
+			change.Items[before.ID] = old
+		}
+	})
+}
+
+// queueChange pushes back the pending change notification for the event, keeping the
+// earliest state of anything it already knew about
+func queueChange(db *sql.DB, eventID string, update func(*scheduleChange)) {
+	name := changeJobName(eventID)
+
+	err := jobs.EnqueueMerged(db, name, "event-changed", func(pending json.RawMessage) (any, time.Time, error) {
+		change := scheduleChange{EventID: eventID}
+		if pending != nil {
+			if err := json.Unmarshal(pending, &change); err != nil {
+				log.Printf("Error reading pending change notification for event %s: %v", eventID, err)
+			}
+		}
+		if change.Items == nil {
+			change.Items = map[string]slot{}
+		}
+
+		update(&change)
+		return change, time.Now().Add(changeDebounce), nil
+	})
+	if err != nil {
+		log.Printf("Error queueing change notification for event %s: %v", eventID, err)
+	}
+}
+
+// notifyScheduleChange sends the followers of an event what changed since the first edit
+func notifyScheduleChange(db *sql.DB) jobs.Handler {
+	return func(ctx context.Context, job jobs.Job) error {
+		var change scheduleChange
+		if err := json.Unmarshal(job.Payload, &change); err != nil {
+			return err
+		}
+
+		event, err := database.GetEvent(db, change.EventID)
+		if err == sql.ErrNoRows {
+			// Deleted since, nothing to tell anyone
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		lines := make([]string, 0)
+		if change.Event != nil {
+			lines = append(lines, describeChange(*change.Event, eventSlot(event))...)
+		}
+		for id, old := range change.Items {
+			item, err := database.GetAgendaItem(db, id)
+			if err == sql.ErrNoRows {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if item.Published {
+				lines = append(lines, describeChange(old, agendaSlot(item))...)
+			}
+		}
+
+		if len(lines) == 0 {
+			return nil
+		}
+
+		targets := []database.Target{{Type: database.TargetEvent, ID: event.ID}}
+		audience, err := database.CountAudience(db, targets)
+		if err != nil {
+			return err
+		}
+		if audience.Users == 0 {
+			return nil
+		}
+
+		notification := database.Notification{
+			Title:       "Schedule change: " + event.Name,
+			Description: strings.Join(lines, " "),
+			Date:        time.Now(),
+			Published:   true,
+			Private:     true,
+			Targets:     targets,
+			Type:        "event",
+			Status:      database.StatusSent,
+			CreatedBy:   "Schedule changes",
+			Link:        &database.Link{Type: database.LinkEvent, ID: event.ID},
+		}
+		if err := database.InsertNotification(db, &notification, ""); err != nil {
+			return err
+		}
+		database.AddNotificationToCache(notification)
+
+		log.Printf("Notifying %d followers of changes to event %s", audience.Users, event.ID)
+		QueueNotification(db, notification)
+		return nil
+	}
+}
+
+// describeChange says how a slot moved or was retimed, nothing if it ended up the same
+func describeChange(before slot, after slot) []string {
+	lines := make([]string, 0, 2)
+
+	if before.moved(after) {
+		lines = append(lines, fmt.Sprintf("%s has moved to %s.", after.Title, after.Location))
+	}
+	if before.retimed(after) {
+		when := after.Start.Format("3:04 PM")
+		if after.Start.YearDay() != before.Start.YearDay() || after.Start.Year() != before.Start.Year() {
+			when = after.Start.Format("Monday, January 2 at 3:04 PM")
+		}
+		lines = append(lines, fmt.Sprintf("%s now starts at %s and ends at %s.", after.Title, when, after.End.Format("3:04 PM")))
+	}
+
+	return lines
+}
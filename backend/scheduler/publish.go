@@ -0,0 +1,40 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"log"
+
+	"prorickey/nctsa/database"
+	"prorickey/nctsa/jobs"
+)
+
+// publishDue publishes scheduled agenda items and notifications once their publishAt
+// time comes around. Notifications are sent as they are published.
+func publishDue(db *sql.DB) jobs.Handler {
+	return func(ctx context.Context, job jobs.Job) error {
+		agendas, err := database.ClaimDueAgenda(db)
+		if err != nil {
+			return err
+		}
+		for _, item := range agendas {
+			log.Printf("Published scheduled agenda item %s", item.ID)
+			// Only the general agenda is cached, event schedules are read straight from the database
+			if item.EventId == "" {
+				database.UpdateAgendaItemInCache(item)
+			}
+		}
+
+		notis, err := database.ClaimDueNotifications(db)
+		if err != nil {
+			return err
+		}
+		for _, noti := range notis {
+			log.Printf("Publishing scheduled notification %s", noti.ID)
+			database.UpdateNotificationInCache(noti)
+			QueueNotification(db, noti)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,108 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+
+	"prorickey/nctsa/database"
+	"prorickey/nctsa/jobs"
+	"prorickey/nctsa/notifications"
+)
+
+/*
+Instead of the apps polling, a silent push tells them to refetch a collection
+when it changes. Changes come in bursts while admins edit, so each collection
+gets at most one refresh push per refreshThrottle. The first change queues it
+and later ones only add who it has to go to. Unlike the schedule change
+notifications this doesn't wait for edits to stop, so a long editing session
+still reaches the apps every refreshThrottle.
+*/
+
+const refreshThrottle = 30 * time.Second
+
+// pendingRefresh is the payload of a queued refresh push
+type pendingRefresh struct {
+	Collection string            `json:"collection"`
+	Targets    []database.Target `json:"targets"`
+	RunAt      time.Time         `json:"runAt"`
+}
+
+func refreshJobName(collection string) string {
+	return "content-refresh:" + collection
+}
+
+// mergeTargets adds the targets that aren't already there, everything collapses into
+// the all target once it is there
+func mergeTargets(targets []database.Target, more []database.Target) []database.Target {
+	if database.TargetsAll(targets) || database.TargetsAll(more) {
+		return []database.Target{{Type: database.TargetAll}}
+	}
+
+	for _, target := range more {
+		found := false
+		for _, existing := range targets {
+			if existing == target {
+				found = true
+				break
+			}
+		}
+		if !found {
+			targets = append(targets, target)
+		}
+	}
+
+	return targets
+}
+
+// queueRefresh makes sure a refresh push for the change's collection is on its way
+func queueRefresh(db *sql.DB, change database.Change) {
+	if !change.Visible {
+		return
+	}
+
+	targets := change.Targets
+	if change.Collection != database.CollectionNotifications {
+		targets = []database.Target{{Type: database.TargetAll}}
+	}
+
+	name := refreshJobName(change.Collection)
+	err := jobs.EnqueueMerged(db, name, "content-refresh", func(pending json.RawMessage) (any, time.Time, error) {
+		refresh := pendingRefresh{Collection: change.Collection, RunAt: time.Now().Add(refreshThrottle)}
+		if pending != nil {
+			if err := json.Unmarshal(pending, &refresh); err != nil {
+				log.Printf("Error reading pending %s refresh: %v", change.Collection, err)
+			}
+		}
+
+		// Pushing it back would starve the apps while edits keep coming, it goes out when first planned
+		refresh.Targets = mergeTargets(refresh.Targets, targets)
+		return refresh, refresh.RunAt, nil
+	})
+	if err != nil {
+		log.Printf("Error queueing %s refresh: %v", change.Collection, err)
+	}
+}
+
+// sendRefresh sends the silent push telling the apps to refetch a collection, browsers
+// are left out
+func sendRefresh(db *sql.DB) jobs.Handler {
+	return func(ctx context.Context, job jobs.Job) error {
+		var refresh pendingRefresh
+		if err := json.Unmarshal(job.Payload, &refresh); err != nil {
+			return err
+		}
+
+		devices, err := database.GetAudienceDevices(db, refresh.Targets)
+		if err != nil {
+			return err
+		}
+
+		return notifications.SendSilent(db, notifications.SilentDevices(devices), map[string]string{
+			"type":       "refresh",
+			"collection": refresh.Collection,
+		})
+	}
+}
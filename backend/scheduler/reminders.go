@@ -0,0 +1,37 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"prorickey/nctsa/database"
+	"prorickey/nctsa/jobs"
+	"prorickey/nctsa/notifications"
+)
+
+// reminderRetention is how long sent reminders are remembered, long enough that
+// nothing is still coming up for them
+const reminderRetention = 2 * 24 * time.Hour
+
+// sendReminders pushes reminders for the agenda items that are about to start
+func sendReminders(db *sql.DB) jobs.Handler {
+	return func(ctx context.Context, job jobs.Job) error {
+		reminders, err := database.ClaimDueReminders(db)
+		if err != nil {
+			return err
+		}
+
+		for _, reminder := range reminders {
+			if err := notifications.SendReminder(db, reminder); err != nil {
+				log.Printf("Error queueing reminder of %s for user %s: %v", reminder.AgendaID, reminder.UserID, err)
+			}
+		}
+		if len(reminders) > 0 {
+			log.Printf("Queued %d reminders", len(reminders))
+		}
+
+		return database.PruneReminders(db, time.Now().Add(-reminderRetention))
+	}
+}
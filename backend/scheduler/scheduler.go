@@ -0,0 +1,89 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"log"
+	"time"
+
+	"prorickey/nctsa/database"
+	"prorickey/nctsa/jobs"
+)
+
+// jobRunRetention is how long the history of job runs is kept
+const jobRunRetention = 14 * 24 * time.Hour
+
+// finishedJobRetention is how long one-shot jobs stay listed after they've run, they
+// pile up quickly since every edited event gets one
+const finishedJobRetention = 24 * time.Hour
+
+// pushQueueRetention is how long sent and failed pushes stay in the queue
+const pushQueueRetention = 7 * 24 * time.Hour
+
+// RegisterJobs registers the handlers of all the background jobs and makes sure the
+// recurring ones are scheduled. It has to be called on every replica before jobs.Start.
+func RegisterJobs(db *sql.DB) {
+	jobs.Register("publish-scheduled", publishDue(db))
+	jobs.Register("purge-trash", purgeTrash(db))
+	jobs.Register("prune-job-runs", pruneJobRuns(db))
+	jobs.Register("prune-push-queue", prunePushQueue(db))
+	jobs.Register("event-changed", notifyScheduleChange(db))
+	jobs.Register("send-reminders", sendReminders(db))
+	jobs.Register("content-refresh", sendRefresh(db))
+	jobs.Register("send-notification", resendNotification(db))
+
+	// Edits happen in request handlers, the refresh is queued off the request
+	database.OnChange(func(change database.Change) {
+		go queueRefresh(db, change)
+	})
+
+	recurring := []struct {
+		name string
+		spec string
+	}{
+		{"publish-scheduled", "@every 15s"},
+		{"purge-trash", "0 * * * *"},
+		{"prune-job-runs", "30 * * * *"},
+		{"prune-push-queue", "45 3 * * *"},
+		{"send-reminders", "@every 1m"},
+	}
+
+	for _, job := range recurring {
+		if err := jobs.Recurring(db, job.name, job.name, job.spec, nil); err != nil {
+			log.Printf("Error scheduling job %s: %v", job.name, err)
+		}
+	}
+}
+
+// purgeTrash permanently deletes anything that has been in the trash longer than the retention window
+func purgeTrash(db *sql.DB) jobs.Handler {
+	return func(ctx context.Context, job jobs.Job) error {
+		return database.PurgeTrash(db, time.Now().Add(-database.TrashRetention()))
+	}
+}
+
+// pruneJobRuns keeps the job run history and the list of finished one-shot jobs from growing forever
+func pruneJobRuns(db *sql.DB) jobs.Handler {
+	return func(ctx context.Context, job jobs.Job) error {
+		if err := jobs.PruneRuns(db, time.Now().Add(-jobRunRetention)); err != nil {
+			return err
+		}
+
+		pruned, err := jobs.PruneFinished(db, time.Now().Add(-finishedJobRetention))
+		if err == nil && pruned > 0 {
+			log.Printf("Pruned %d finished one-shot jobs", pruned)
+		}
+		return err
+	}
+}
+
+// prunePushQueue clears out finished pushes
+func prunePushQueue(db *sql.DB) jobs.Handler {
+	return func(ctx context.Context, job jobs.Job) error {
+		pruned, err := database.PrunePushQueue(db, time.Now().Add(-pushQueueRetention))
+		if err == nil && pruned > 0 {
+			log.Printf("Pruned %d finished pushes", pruned)
+		}
+		return err
+	}
+}
@@ -0,0 +1,76 @@
+package scheduler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"log"
+	"time"
+
+	"prorickey/nctsa/database"
+	"prorickey/nctsa/jobs"
+	"prorickey/nctsa/notifications"
+)
+
+/*
+A notification is saved as published before its pushes are queued, so if queueing
+fails it would show as sent with nothing going out. Instead it is handed to the
+send-notification job, which the job runner tries again with backoff until it
+works or runs out of attempts. Queueing is a single insert, so a failed attempt
+never left half the pushes behind to be sent twice.
+*/
+
+// sendRetryDelay is how long to wait before the first try after queueing failed
+const sendRetryDelay = 30 * time.Second
+
+// pendingSend is the payload of a send-notification job
+type pendingSend struct {
+	NotificationID string `json:"notificationId"`
+}
+
+func sendJobName(notificationID string) string {
+	return "send-notification:" + notificationID
+}
+
+// QueueNotification queues the pushes of a notification that was just published, if that
+// fails the send-notification job keeps trying
+func QueueNotification(db *sql.DB, noti database.Notification) {
+	if err := notifications.SendNotification(db, noti); err != nil {
+		log.Printf("Error queueing notification %s, trying again later: %v", noti.ID, err)
+
+		err := jobs.Enqueue(db, sendJobName(noti.ID), "send-notification", time.Now().Add(sendRetryDelay), pendingSend{NotificationID: noti.ID})
+		if err != nil {
+			log.Printf("Error scheduling another try at queueing notification %s: %v", noti.ID, err)
+		}
+	}
+}
+
+// resendNotification tries again to queue a notification whose pushes failed to queue,
+// returning the error has the job runner try again later
+func resendNotification(db *sql.DB) jobs.Handler {
+	return func(ctx context.Context, job jobs.Job) error {
+		var pending pendingSend
+		if err := json.Unmarshal(job.Payload, &pending); err != nil {
+			return err
+		}
+
+		noti, err := database.GetNotification(db, pending.NotificationID)
+		if err == sql.ErrNoRows {
+			// Deleted since, nothing to send
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !noti.Published || noti.RetractedAt != nil {
+			return nil
+		}
+
+		if err := notifications.SendNotification(db, noti); err != nil {
+			return err
+		}
+
+		log.Printf("Queued notification %s on try %d", pending.NotificationID, job.Attempt+1)
+		return nil
+	}
+}
@@ -0,0 +1,366 @@
+package stream
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"prorickey/nctsa/database"
+
+	"github.com/redis/go-redis/v9"
+)
+
+/*
+Live updates for the apps over server-sent events. Whenever the cached agenda,
+events or notifications change on a replica the change is added to a capped
+redis stream and announced on a pub/sub channel. Every replica listens on the
+channel and reads the new entries from the stream in order, handing them to
+the clients connected to it. The entry ids are the cursor apps resume from
+after reconnecting, as long as the entry hasn't been trimmed off the stream.
+*/
+
+const (
+	changesKey      = "STREAM:CHANGES"
+	liveChannel     = "STREAM:LIVE"
+	historyLength   = 1000
+	readBatch       = 200
+	catchUpInterval = 5 * time.Second // In case an announcement is missed while redis reconnects
+	clientBuffer    = 64
+)
+
+var ErrCursorExpired = errors.New("cursor is no longer in the stream")
+
+// Event is a change as it is sent to the apps. Targets is who a notification is for,
+// it decides who gets the event but isn't sent.
+type Event struct {
+	Cursor     string            `json:"-"`
+	Collection string            `json:"collection"`
+	Action     string            `json:"action"`
+	ID         string            `json:"id"`
+	Emergency  bool              `json:"emergency,omitempty"`
+	Targets    []database.Target `json:"-"`
+}
+
+// Name is the server-sent event name, emergencies get their own so apps can show them right away
+func (e Event) Name() string {
+	if e.Emergency {
+		return "emergency"
+	}
+	return e.Collection
+}
+
+// Client is a connection waiting for events. Lagged is closed if it falls too far
+// behind, the app reconnects with its cursor and catches up from the stream.
+type Client struct {
+	UserID string
+	Events chan Event
+	Lagged chan struct{}
+
+	lagOnce sync.Once
+}
+
+func (c *Client) lag() {
+	c.lagOnce.Do(func() { close(c.Lagged) })
+}
+
+var (
+	clientsMu sync.Mutex
+	clients   = map[*Client]bool{}
+
+	changes = make(chan database.Change, 256)
+)
+
+// Start publishes the changes made on this replica and hands every replica's changes
+// to the clients connected here
+func Start(db *sql.DB, rdb *redis.Client) {
+	database.OnChange(func(change database.Change) {
+		if !change.Visible {
+			return
+		}
+
+		select {
+		case changes <- change:
+		default:
+			log.Printf("Stream is backed up, dropping %s change to %s", change.Collection, change.ID)
+		}
+	})
+
+	go func() {
+		for change := range changes {
+			publish(rdb, change)
+		}
+	}()
+	go listen(db, rdb)
+}
+
+// Subscribe connects a client for the user
+func Subscribe(userID string) *Client {
+	client := &Client{UserID: userID, Events: make(chan Event, clientBuffer), Lagged: make(chan struct{})}
+
+	clientsMu.Lock()
+	clients[client] = true
+	clientsMu.Unlock()
+
+	return client
+}
+
+// Unsubscribe disconnects a client
+func Unsubscribe(client *Client) {
+	clientsMu.Lock()
+	delete(clients, client)
+	clientsMu.Unlock()
+}
+
+// publish adds the change to the stream and tells the replicas about it
+func publish(rdb *redis.Client, change database.Change) {
+	ctx := context.Background()
+
+	targets, err := json.Marshal(change.Targets)
+	if err != nil {
+		log.Printf("Error encoding targets of %s change to %s: %v", change.Collection, change.ID, err)
+		return
+	}
+
+	emergency := "0"
+	if change.Emergency {
+		emergency = "1"
+	}
+
+	id, err := rdb.XAdd(ctx, &redis.XAddArgs{
+		Stream: changesKey,
+		MaxLen: historyLength,
+		Approx: true,
+		Values: map[string]interface{}{
+			"collection": change.Collection,
+			"action":     change.Action,
+			"id":         change.ID,
+			"emergency":  emergency,
+			"targets":    string(targets),
+		},
+	}).Result()
+	if err != nil {
+		log.Printf("Error adding %s change to %s to the stream: %v", change.Collection, change.ID, err)
+		return
+	}
+
+	if err := rdb.Publish(ctx, liveChannel, id).Err(); err != nil {
+		log.Printf("Error announcing stream entry %s: %v", id, err)
+	}
+}
+
+// listen reads new entries off the stream whenever one is announced and hands them out
+func listen(db *sql.DB, rdb *redis.Client) {
+	announced := rdb.Subscribe(context.Background(), liveChannel).Channel()
+
+	last := ""
+	for {
+		if last == "" {
+			latest, err := Latest(rdb)
+			if err != nil {
+				log.Printf("Error reading the end of the stream: %v", err)
+			}
+			last = latest
+		} else {
+			last = catchUp(db, rdb, last)
+		}
+
+		select {
+		case <-announced:
+		case <-time.After(catchUpInterval):
+		}
+	}
+}
+
+// catchUp hands out the entries after last and returns the newest one handed out
+func catchUp(db *sql.DB, rdb *redis.Client, last string) string {
+	for {
+		events, err := read(rdb, last)
+		if err != nil {
+			log.Printf("Error reading the stream after %s: %v", last, err)
+			return last
+		}
+
+		for _, event := range events {
+			broadcast(db, event)
+			last = event.Cursor
+		}
+
+		if len(events) < readBatch {
+			return last
+		}
+	}
+}
+
+// broadcast hands the event to every client here that can see it. Clients that are too
+// far behind are dropped rather than holding everyone else up.
+func broadcast(db *sql.DB, event Event) {
+	clientsMu.Lock()
+	connected := make([]*Client, 0, len(clients))
+	userIDs := make([]string, 0, len(clients))
+	for client := range clients {
+		connected = append(connected, client)
+		userIDs = append(userIDs, client.UserID)
+	}
+	clientsMu.Unlock()
+
+	if len(connected) == 0 {
+		return
+	}
+
+	audience, err := audienceOf(db, event, userIDs)
+	if err != nil {
+		log.Printf("Error finding who can see %s change to %s: %v", event.Collection, event.ID, err)
+		return
+	}
+
+	for _, client := range connected {
+		if audience != nil && !audience[client.UserID] {
+			continue
+		}
+
+		select {
+		case client.Events <- event:
+		default:
+			client.lag()
+		}
+	}
+}
+
+// audienceOf returns which of the users can see the event, nil if everyone can
+func audienceOf(db *sql.DB, event Event, userIDs []string) (map[string]bool, error) {
+	if event.Collection != database.CollectionNotifications || database.TargetsAll(event.Targets) {
+		return nil, nil
+	}
+
+	return database.UsersInAudience(db, event.Targets, userIDs)
+}
+
+// Since returns the events after the cursor the user can see, or ErrCursorExpired if
+// some of them have been trimmed off the stream
+func Since(db *sql.DB, rdb *redis.Client, userID string, cursor string) ([]Event, error) {
+	if _, _, ok := parseCursor(cursor); !ok {
+		return nil, ErrCursorExpired
+	}
+
+	oldest, err := rdb.XRangeN(context.Background(), changesKey, "-", "+", 1).Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(oldest) == 0 || After(oldest[0].ID, cursor) {
+		// The cursor was trimmed off (or redis lost the stream), so some changes may be missing
+		return nil, ErrCursorExpired
+	}
+
+	visible := make([]Event, 0)
+	for {
+		events, err := read(rdb, cursor)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, event := range events {
+			cursor = event.Cursor
+
+			audience, err := audienceOf(db, event, []string{userID})
+			if err != nil {
+				return nil, err
+			}
+			if audience == nil || audience[userID] {
+				visible = append(visible, event)
+			}
+		}
+
+		if len(events) < readBatch {
+			return visible, nil
+		}
+	}
+}
+
+// Latest returns the cursor of the newest entry in the stream
+func Latest(rdb *redis.Client) (string, error) {
+	newest, err := rdb.XRevRangeN(context.Background(), changesKey, "+", "-", 1).Result()
+	if err != nil {
+		return "", err
+	}
+	if len(newest) == 0 {
+		return "0-0", nil
+	}
+
+	return newest[0].ID, nil
+}
+
+// read returns a batch of the entries after the cursor
+func read(rdb *redis.Client, cursor string) ([]Event, error) {
+	messages, err := rdb.XRangeN(context.Background(), changesKey, "("+cursor, "+", readBatch).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]Event, 0, len(messages))
+	for _, message := range messages {
+		event := Event{Cursor: message.ID}
+		event.Collection, _ = message.Values["collection"].(string)
+		event.Action, _ = message.Values["action"].(string)
+		event.ID, _ = message.Values["id"].(string)
+		emergency, _ := message.Values["emergency"].(string)
+		event.Emergency = emergency == "1"
+
+		if targets, _ := message.Values["targets"].(string); targets != "" {
+			if err := json.Unmarshal([]byte(targets), &event.Targets); err != nil {
+				log.Printf("Error reading targets of stream entry %s: %v", message.ID, err)
+				continue
+			}
+		}
+
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// After reports whether cursor a comes after cursor b
+func After(a string, b string) bool {
+	return compareCursors(a, b) > 0
+}
+
+// compareCursors orders two stream entry ids, which are milliseconds-sequence
+func compareCursors(a string, b string) int {
+	aMs, aSeq, _ := parseCursor(a)
+	bMs, bSeq, _ := parseCursor(b)
+
+	switch {
+	case aMs < bMs:
+		return -1
+	case aMs > bMs:
+		return 1
+	case aSeq < bSeq:
+		return -1
+	case aSeq > bSeq:
+		return 1
+	}
+	return 0
+}
+
+func parseCursor(cursor string) (uint64, uint64, bool) {
+	msPart, seqPart, found := strings.Cut(cursor, "-")
+	if !found {
+		return 0, 0, false
+	}
+
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+
+	return ms, seq, true
+}
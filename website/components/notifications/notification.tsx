@@ -8,5 +8,15 @@ export interface Notification {
   published: boolean;
   category: 'general' | 'event' | 'chapter';
   private: boolean;
-  userids?: string[];
-}
\ No newline at end of file
+  userids?: string[]; // Only sent when creating, the backend turns them into targets
+  targets?: Target[];
+}
+
+// Who a notification is for, see /admin/notifications in ROUTES.md
+export interface Target {
+  type: 'all' | 'user' | 'school' | 'event' | 'role' | 'advisors';
+  id?: string;
+}
+
+// How many users, schools and events the recipient search shows of each
+export const searchLimit = 20;
@@ -1,7 +1,7 @@
 'use client';
 
 import React, { useState, useEffect } from 'react';
-import { Notification } from './notification';
+import { Notification, Target, searchLimit } from './notification';
 
 interface NotificationEditorProps {
 	notification: Notification;
@@ -25,7 +25,10 @@ const NotificationEditor: React.FC<NotificationEditorProps> = ({ notification, a
     const [searchTerm, setSearchTerm] = useState('');
     const [searchResults, setSearchResults] = useState<Array<{id: string, name: string, type: 'user' | 'school' | 'event'}>>([]);
     const [isSearching, setIsSearching] = useState(false);
-    const [isLoadingRecipients, setIsLoadingRecipients] = useState(notification.userids?.length != null && notification.userids?.length > 0);
+    // Role and advisor targets can't be picked here, they are kept as they are when saving
+    const recipientTargets = (notification.targets || []).filter(t => t.type === 'user' || t.type === 'school' || t.type === 'event');
+    const otherTargets = (notification.targets || []).filter(t => t.type === 'role' || t.type === 'advisors');
+    const [isLoadingRecipients, setIsLoadingRecipients] = useState(recipientTargets.length > 0);
 
     interface User {
         id: string;
@@ -44,39 +47,40 @@ const NotificationEditor: React.FC<NotificationEditorProps> = ({ notification, a
     // Load recipient details if there are recipients
     useEffect(() => {
         const loadRecipientDetails = async () => {
-            if (!notification.userids || notification.userids.length === 0) {
+            if (recipientTargets.length === 0) {
                 setIsLoadingRecipients(false);
                 return;
             }
     
             try {
-                // Extract all IDs from notification.userids
-                const ids = notification.userids
-                
-                // Fetch all users and schools in parallel
-                const [usersResponse, schoolsResponse, eventsResponse] = await Promise.all([
-                    fetch(`${apiUrl}/admin/users`, {
-                        headers: {
-                            "Authorization": `Bearer ${apiKey}`,
-                        }
-                    }),
-                    fetch(`${apiUrl}/admin/schools`, {
-                        headers: {
-                            "Authorization": `Bearer ${apiKey}`,
-                        }
-                    }),
-                    fetch(`${apiUrl}/admin/s/events`, {
-                        headers: {
-                            "Authorization": `Bearer ${apiKey}`,
+
+                // Look up just the recipients, by id
+                const lookup = async <T,>(path: string, type: string): Promise<T[]> => {
+                    const ids = recipientTargets.filter(t => t.type === type && t.id).map(t => t.id!);
+                    const responses = await Promise.all(ids.map(id =>
+                        fetch(`${apiUrl}/admin/${path}?id=${encodeURIComponent(id)}&limit=1`, {
+                            headers: {
+                                "Authorization": `Bearer ${apiKey}`,
+                            }
+                        })
+                    ));
+
+                    const found: T[] = [];
+                    for (const response of responses) {
+                        if (response.ok) {
+                            const { items } = await response.json();
+                            found.push(...items);
                         }
-                    })
+                    }
+                    return found;
+                };
+
+                const [users, schools, events] = await Promise.all([
+                    lookup<User>('users', 'user'),
+                    lookup<School>('schools', 'school'),
+                    lookup<Event>('s/events', 'event'),
                 ]);
                 
-                // Parse the responses
-                const users = usersResponse.ok ? await usersResponse.json() : [];
-                const schools = schoolsResponse.ok ? await schoolsResponse.json() : [];
-                const events = eventsResponse.ok ? await eventsResponse.json() : [];
-                
                 // Create maps for faster lookups
                 const userMap = new Map<string, User>();
                 users.forEach((user: User) => {
@@ -93,23 +97,24 @@ const NotificationEditor: React.FC<NotificationEditorProps> = ({ notification, a
                     eventMap.set(evt.id, evt)
                 })
                 
-                // Map IDs to recipient objects with names
-                const updatedRecipients = ids.map(id => {
-                    if (userMap.has(id)) {
+                // Map targets to recipient objects with names
+                const updatedRecipients = recipientTargets.map(target => {
+                    const id = target.id || '';
+                    if (target.type === 'user' && userMap.has(id)) {
                         const user = userMap.get(id)!;
                         return {
                             id,
                             name: `${user.fullName} (${user.shortName})`,
                             type: 'user' as const
                         };
-                    } else if (schoolMap.has(id)) {
+                    } else if (target.type === 'school' && schoolMap.has(id)) {
                         const school = schoolMap.get(id)!;
                         return {
                             id,
                             name: `${school.name} (School)`,
                             type: 'school' as const
                         };
-                    } else if(eventMap.has(id)) {
+                    } else if (target.type === 'event' && eventMap.has(id)) {
                         const evt = eventMap.get(id)!;
                         return {
                             id,
@@ -120,7 +125,7 @@ const NotificationEditor: React.FC<NotificationEditorProps> = ({ notification, a
                         return {
                             id,
                             name: "Unknown Recipient",
-                            type: 'user' as const // Default type
+                            type: target.type as 'user' | 'school' | 'event'
                         };
                     }
                 });
@@ -134,7 +139,7 @@ const NotificationEditor: React.FC<NotificationEditorProps> = ({ notification, a
         };
     
         loadRecipientDetails();
-    }, [notification.userids, apiUrl, apiKey]);
+    }, [notification.targets, apiUrl, apiKey]);
 
     // Search for users and schools
     const searchRecipientsDebounced = async (term: string) => {
@@ -146,21 +151,21 @@ const NotificationEditor: React.FC<NotificationEditorProps> = ({ notification, a
         setIsSearching(true);
         try {
             // Fetch users
-            const usersResponse = await fetch(`${apiUrl}/admin/users?search=${encodeURIComponent(term)}`, {
+            const usersResponse = await fetch(`${apiUrl}/admin/users?search=${encodeURIComponent(term)}&limit=${searchLimit}`, {
                 headers: {
                     "Authorization": `Bearer ${apiKey}`,
                 }
             });
             
             // Fetch schools
-            const schoolsResponse = await fetch(`${apiUrl}/admin/schools?search=${encodeURIComponent(term)}`, {
+            const schoolsResponse = await fetch(`${apiUrl}/admin/schools?search=${encodeURIComponent(term)}&limit=${searchLimit}`, {
                 headers: {
                     "Authorization": `Bearer ${apiKey}`,
                 }
             });
 
             // Fetch events
-            const eventsResponse = await fetch(`${apiUrl}/admin/s/events?search=${encodeURIComponent(term)}`, {
+            const eventsResponse = await fetch(`${apiUrl}/admin/s/events?search=${encodeURIComponent(term)}&limit=${searchLimit}`, {
                 headers: {
                     "Authorization": `Bearer ${apiKey}`,
                 }
@@ -170,9 +175,9 @@ const NotificationEditor: React.FC<NotificationEditorProps> = ({ notification, a
                 throw new Error('Failed to fetch search results');
             }
 
-            const users = await usersResponse.json();
-            const schools = await schoolsResponse.json();
-            const events = await eventsResponse.json();
+            const { items: users } = await usersResponse.json();
+            const { items: schools } = await schoolsResponse.json();
+            const { items: events } = await eventsResponse.json();
 
             // Format results
             const formattedUsers = users.map((user: User) => ({
@@ -249,6 +254,17 @@ const NotificationEditor: React.FC<NotificationEditorProps> = ({ notification, a
 		});
 	};
 
+    // The targets to save, everyone unless the notification is private
+    const buildTargets = (): Target[] => {
+        if (!isPrivate) {
+            return [{ type: 'all' }];
+        }
+        return [
+            ...selectedRecipients.map(recipient => ({ type: recipient.type, id: recipient.id })),
+            ...otherTargets,
+        ];
+    };
+
     // Handle private toggle
     const handlePrivateChange = (e: React.ChangeEvent<HTMLInputElement>) => {
         setIsPrivate(e.target.checked);
@@ -263,10 +279,7 @@ const NotificationEditor: React.FC<NotificationEditorProps> = ({ notification, a
             const payload = {
                 ...formData,
                 private: isPrivate,
-                recipients: isPrivate ? selectedRecipients.map(recipient => ({
-                    id: recipient.id,
-                    type: recipient.type
-                })) : []
+                targets: buildTargets(),
             };
             
 			const response = await fetch(`${apiUrl}/admin/notifications/${formData.id}`, {
@@ -297,11 +310,8 @@ const NotificationEditor: React.FC<NotificationEditorProps> = ({ notification, a
             // Prepare the request payload
             const payload = {
                 ...formData,
-                isPrivate: isPrivate,
-                recipients: isPrivate ? selectedRecipients.map(recipient => ({
-                    id: recipient.id,
-                    type: recipient.type
-                })) : [],
+                private: isPrivate,
+                targets: buildTargets(),
                 published: true
             };
             
@@ -1,5 +1,5 @@
 import React, { useState, useEffect } from 'react';
-import { Notification } from './notification';
+import { Notification, searchLimit } from './notification';
 
 interface NotificationFormProps {
   formData: Partial<Notification>;
@@ -41,21 +41,21 @@ const NotificationForm: React.FC<NotificationFormProps> = ({
 
     try {
       // Fetch users
-      const usersResponse = await fetch(`${apiUrl}/admin/users?search=${encodeURIComponent(term)}`, {
+      const usersResponse = await fetch(`${apiUrl}/admin/users?search=${encodeURIComponent(term)}&limit=${searchLimit}`, {
         headers: {
           "Authorization": `Bearer ${apiKey}`,
         }
       });
       
       // Fetch schools
-      const schoolsResponse = await fetch(`${apiUrl}/admin/schools?search=${encodeURIComponent(term)}`, {
+      const schoolsResponse = await fetch(`${apiUrl}/admin/schools?search=${encodeURIComponent(term)}&limit=${searchLimit}`, {
         headers: {
           "Authorization": `Bearer ${apiKey}`,
         }
       });
 
       // Fetch events by search
-      const eventsResponse = await fetch(`${apiUrl}/admin/s/events?search=${encodeURIComponent(term)}`, {
+      const eventsResponse = await fetch(`${apiUrl}/admin/s/events?search=${encodeURIComponent(term)}&limit=${searchLimit}`, {
         headers: {
           "Authorization": `Bearer ${apiKey}`,
         }
@@ -65,9 +65,9 @@ const NotificationForm: React.FC<NotificationFormProps> = ({
         throw new Error('Failed to fetch search results');
       }
 
-      const users = await usersResponse.json();
-      const schools = await schoolsResponse.json();
-      const events = await eventsResponse.json();
+      const { items: users } = await usersResponse.json();
+      const { items: schools } = await schoolsResponse.json();
+      const { items: events } = await eventsResponse.json();
 
       interface User {
         id: string;